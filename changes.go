@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/harlequix/godoist"
+)
+
+// change describes a single field mutation automadoist makes (or would make) on a task,
+// or on a project when ProjectID is set.
+type change struct {
+	TaskID    string      `json:"task_id,omitempty"`
+	ProjectID string      `json:"project_id,omitempty"`
+	Content   string      `json:"content"`
+	Field     string      `json:"field"`
+	Old       interface{} `json:"old"`
+	New       interface{} `json:"new"`
+	Reason    string      `json:"reason"`
+}
+
+// target identifies the task or project a change applies to.
+func (c change) target() string {
+	if c.ProjectID != "" {
+		return "project " + c.ProjectID
+	}
+	if c.TaskID == "" && c.Field == "created" {
+		return "new task in " + taskValue(c.Content, c.New).ProjectID
+	}
+	return c.TaskID
+}
+
+// changeSet is the single path through which the pipelines mutate tasks.
+// Every applied change is recorded, and appended to the journal if one is set.
+// In dry-run mode changes are only applied to the in-memory task, so later
+// steps see the planned state while the API is never written to.
+type changeSet struct {
+	store   taskStore
+	dryRun  bool
+	journal *journal
+	mu      sync.Mutex
+	changes []change
+	// contexts holds the context comments written by this change set, so
+	// later steps see them without re-reading, also in dry-run mode.
+	contexts map[string]map[string]interface{}
+}
+
+func newChangeSet(store taskStore, dryRun bool) *changeSet {
+	return &changeSet{store: store, dryRun: dryRun, contexts: map[string]map[string]interface{}{}}
+}
+
+func (cs *changeSet) record(c change) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.changes = append(cs.changes, c)
+	if cs.journal != nil && !cs.dryRun {
+		if err := cs.journal.append(c); err != nil {
+			logger.Error("Failed to write journal", "path", cs.journal.path, "error", err)
+		}
+	}
+}
+
+// Changes returns a copy of all changes recorded so far, in the order they were made.
+func (cs *changeSet) Changes() []change {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	out := make([]change, len(cs.changes))
+	copy(out, cs.changes)
+	return out
+}
+
+// setLabels replaces the task's labels. It is a no-op if the label sets are equal.
+func (cs *changeSet) setLabels(t *godoist.Task, labels []string, reason string) error {
+	if sameLabels(t.Labels, labels) {
+		return nil
+	}
+	old := append([]string{}, t.Labels...)
+	if cs.dryRun {
+		t.Labels = labels
+	} else if err := cs.store.UpdateTask(t, "labels", labels); err != nil {
+		return err
+	}
+	cs.record(change{TaskID: t.ID, Content: t.Content, Field: "labels", Old: old, New: labels, Reason: reason})
+	return nil
+}
+
+func (cs *changeSet) addLabel(t *godoist.Task, label string, reason string) error {
+	if toSet(t.Labels)[label] {
+		return nil
+	}
+	labels := append(append([]string{}, t.Labels...), label)
+	return cs.setLabels(t, labels, reason)
+}
+
+func (cs *changeSet) removeLabel(t *godoist.Task, label string, reason string) error {
+	labels := []string{}
+	for _, l := range t.Labels {
+		if l != label {
+			labels = append(labels, l)
+		}
+	}
+	if len(labels) == len(t.Labels) {
+		return fmt.Errorf("label not found: %s", label)
+	}
+	return cs.setLabels(t, labels, reason)
+}
+
+// setPriority changes the task's priority. It is a no-op if the priority is unchanged.
+func (cs *changeSet) setPriority(t *godoist.Task, priority godoist.PRIORITY_LEVEL, reason string) error {
+	if t.Priority == priority {
+		return nil
+	}
+	old := t.Priority
+	if cs.dryRun {
+		t.Priority = priority
+	} else if err := cs.store.UpdateTask(t, "priority", priority); err != nil {
+		return err
+	}
+	cs.record(change{TaskID: t.ID, Content: t.Content, Field: "priority", Old: old, New: priority, Reason: reason})
+	return nil
+}
+
+// context returns the task's context comment, empty if it has none.
+func (cs *changeSet) context(t *godoist.Task) (map[string]interface{}, error) {
+	cs.mu.Lock()
+	ctx, ok := cs.contexts[t.ID]
+	cs.mu.Unlock()
+	if ok {
+		return copyContext(ctx), nil
+	}
+	if cs.store == nil {
+		return map[string]interface{}{}, nil
+	}
+	ctx, err := cs.store.GetContext(t)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = map[string]interface{}{}
+	}
+	return ctx, nil
+}
+
+func (cs *changeSet) rememberContext(t *godoist.Task, ctx map[string]interface{}) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.contexts[t.ID] = copyContext(ctx)
+}
+
+// setContext replaces the task's context comment. old is the context being replaced.
+func (cs *changeSet) setContext(t *godoist.Task, old, ctx map[string]interface{}, reason string) error {
+	if !cs.dryRun {
+		if err := cs.store.SetContext(t, ctx); err != nil {
+			return err
+		}
+	}
+	cs.rememberContext(t, ctx)
+	var oldValue interface{}
+	if len(old) > 0 {
+		oldValue = old
+	}
+	cs.record(change{TaskID: t.ID, Content: t.Content, Field: "context", Old: oldValue, New: ctx, Reason: reason})
+	return nil
+}
+
+// deleteContext removes the task's context comment. old is the context being removed.
+func (cs *changeSet) deleteContext(t *godoist.Task, old map[string]interface{}, reason string) error {
+	if !cs.dryRun {
+		if err := cs.store.DeleteContext(t); err != nil {
+			return err
+		}
+	}
+	cs.rememberContext(t, map[string]interface{}{})
+	cs.record(change{TaskID: t.ID, Content: t.Content, Field: "context", Old: old, Reason: reason})
+	return nil
+}
+
+// updateContext merges updates into the task's context comment; a nil value
+// removes the key. The comment is deleted once no keys are left, and nothing
+// is written if the context does not change.
+func (cs *changeSet) updateContext(t *godoist.Task, updates map[string]interface{}, reason string) error {
+	old, err := cs.context(t)
+	if err != nil {
+		return err
+	}
+	ctx := copyContext(old)
+	for k, v := range updates {
+		if v == nil {
+			delete(ctx, k)
+		} else {
+			ctx[k] = v
+		}
+	}
+	if sameContext(old, ctx) {
+		return nil
+	}
+	if len(ctx) == 0 {
+		return cs.deleteContext(t, old, reason)
+	}
+	return cs.setContext(t, old, ctx, reason)
+}
+
+func copyContext(ctx map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(ctx))
+	for k, v := range ctx {
+		out[k] = v
+	}
+	return out
+}
+
+// sameContext compares two contexts by their JSON form, so values decoded
+// from a comment match the typed values they were written from.
+func sameContext(a, b map[string]interface{}) bool {
+	aj, aerr := json.Marshal(a)
+	bj, berr := json.Marshal(b)
+	return aerr == nil && berr == nil && string(aj) == string(bj)
+}
+
+// createTask adds a task. In dry-run mode nothing is created and the change
+// is recorded without a task ID.
+func (cs *changeSet) createTask(t godoist.Task, reason string) (*godoist.Task, error) {
+	created := &t
+	if !cs.dryRun {
+		var err error
+		if created, err = cs.store.AddTask(t); err != nil {
+			return nil, err
+		}
+	}
+	cs.record(change{TaskID: created.ID, Content: t.Content, Field: "created", New: newTaskValue(t), Reason: reason})
+	return created, nil
+}
+
+// closeTask completes a task.
+func (cs *changeSet) closeTask(t *godoist.Task, reason string) error {
+	if !cs.dryRun {
+		if err := cs.store.CloseTask(t); err != nil {
+			return err
+		}
+	}
+	cs.record(change{TaskID: t.ID, Content: t.Content, Field: "closed", Old: false, New: true, Reason: reason})
+	return nil
+}
+
+// reopenTask uncompletes a task closed earlier. Closed tasks are not in the
+// store, so it is given by ID and content.
+func (cs *changeSet) reopenTask(id, content string, reason string) error {
+	if !cs.dryRun {
+		if err := cs.store.ReopenTask(id); err != nil {
+			return err
+		}
+	}
+	cs.record(change{TaskID: id, Content: content, Field: "closed", Old: true, New: false, Reason: reason})
+	return nil
+}
+
+// newTaskValue records where a created task was placed.
+func newTaskValue(t godoist.Task) map[string]interface{} {
+	v := map[string]interface{}{"project_id": t.ProjectID}
+	if t.ParentID != "" {
+		v["parent_id"] = t.ParentID
+	}
+	if len(t.Labels) > 0 {
+		v["labels"] = t.Labels
+	}
+	return v
+}
+
+// taskValue converts a recorded newTaskValue back into a task to create.
+func taskValue(content string, v interface{}) godoist.Task {
+	m, _ := v.(map[string]interface{})
+	t := godoist.Task{Content: content, ProjectID: stringValue(m["project_id"]), ParentID: stringValue(m["parent_id"])}
+	if labels, ok := m["labels"]; ok {
+		t.Labels = labelsValue(labels)
+	}
+	return t
+}
+
+// setProjectDescription replaces a project's description.
+func (cs *changeSet) setProjectDescription(p *godoist.Project, description string, reason string) error {
+	if p.Description == description {
+		return nil
+	}
+	old := p.Description
+	if cs.dryRun {
+		p.Description = description
+	} else if err := cs.store.UpdateProject(p, "description", description); err != nil {
+		return err
+	}
+	cs.record(change{ProjectID: p.ID, Content: p.Name, Field: "description", Old: old, New: description, Reason: reason})
+	return nil
+}
+
+func sameLabels(a, b []string) bool {
+	as, bs := toSet(a), toSet(b)
+	if len(as) != len(bs) {
+		return false
+	}
+	for label := range as {
+		if !bs[label] {
+			return false
+		}
+	}
+	return true
+}
+
+// printChanges writes a human readable, per-task summary of changes to w.
+func printChanges(w io.Writer, changes []change) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No changes.")
+		return
+	}
+	var order []string
+	byTarget := make(map[string][]change)
+	for _, c := range changes {
+		if _, ok := byTarget[c.target()]; !ok {
+			order = append(order, c.target())
+		}
+		byTarget[c.target()] = append(byTarget[c.target()], c)
+	}
+	for _, target := range order {
+		targetChanges := byTarget[target]
+		fmt.Fprintf(w, "%s (%s)\n", targetChanges[0].Content, target)
+		for _, c := range targetChanges {
+			fmt.Fprintf(w, "  %-9s %s -> %s  (%s)\n", c.Field+":", formatValue(c.Old), formatValue(c.New), c.Reason)
+		}
+	}
+	fmt.Fprintf(w, "%d change(s) on %d item(s).\n", len(changes), len(order))
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "-"
+	case []string:
+		sorted := append([]string{}, val...)
+		sort.Strings(sorted)
+		return "[" + strings.Join(sorted, " ") + "]"
+	case godoist.PRIORITY_LEVEL:
+		return val.String()
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
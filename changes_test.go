@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestChangeSetDryRun(t *testing.T) {
+	t.Run("records and applies in memory", func(t *testing.T) {
+		cs := newChangeSet(nil, true)
+		task := &godoist.Task{ID: "1", Content: "Buy milk", Labels: []string{"home"}, Priority: godoist.VERY_LOW}
+
+		if err := cs.setLabels(task, []string{"home", "next"}, "next action"); err != nil {
+			t.Fatalf("setLabels: %v", err)
+		}
+		if err := cs.setPriority(task, godoist.MEDIUM, "project color red"); err != nil {
+			t.Fatalf("setPriority: %v", err)
+		}
+
+		if !reflect.DeepEqual(task.Labels, []string{"home", "next"}) {
+			t.Errorf("Labels = %v, want [home next]", task.Labels)
+		}
+		if task.Priority != godoist.MEDIUM {
+			t.Errorf("Priority = %v, want Medium", task.Priority)
+		}
+		changes := cs.Changes()
+		if len(changes) != 2 {
+			t.Fatalf("got %d changes, want 2", len(changes))
+		}
+		if !reflect.DeepEqual(changes[0].Old, []string{"home"}) {
+			t.Errorf("labels old = %v, want [home]", changes[0].Old)
+		}
+		if changes[1].Old != godoist.VERY_LOW || changes[1].New != godoist.MEDIUM {
+			t.Errorf("priority change = %v -> %v", changes[1].Old, changes[1].New)
+		}
+	})
+
+	t.Run("skips no-op changes", func(t *testing.T) {
+		cs := newChangeSet(nil, true)
+		task := &godoist.Task{ID: "1", Labels: []string{"a", "b"}, Priority: godoist.HIGH}
+		cs.setLabels(task, []string{"b", "a"}, "reorder")
+		cs.setPriority(task, godoist.HIGH, "same")
+		cs.addLabel(task, "a", "present")
+		if n := len(cs.Changes()); n != 0 {
+			t.Errorf("got %d changes, want 0", n)
+		}
+	})
+
+	t.Run("remove missing label", func(t *testing.T) {
+		cs := newChangeSet(nil, true)
+		task := &godoist.Task{ID: "1", Labels: []string{"a"}}
+		if err := cs.removeLabel(task, "b", "test"); err == nil {
+			t.Error("expected error for missing label")
+		}
+		if err := cs.removeLabel(task, "a", "test"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(task.Labels) != 0 {
+			t.Errorf("Labels = %v, want []", task.Labels)
+		}
+	})
+}
+
+func TestPrintChanges(t *testing.T) {
+	t.Run("no changes", func(t *testing.T) {
+		var buf bytes.Buffer
+		printChanges(&buf, nil)
+		if buf.String() != "No changes.\n" {
+			t.Errorf("output = %q", buf.String())
+		}
+	})
+
+	t.Run("groups by task", func(t *testing.T) {
+		var buf bytes.Buffer
+		printChanges(&buf, []change{
+			{TaskID: "1", Content: "Buy milk", Field: "labels", Old: []string{"next", "home"}, New: []string{}, Reason: "no longer a next action"},
+			{TaskID: "2", Content: "Call Bob", Field: "labels", Old: []string{}, New: []string{"next"}, Reason: "next action"},
+			{TaskID: "1", Content: "Buy milk", Field: "priority", Old: godoist.HIGH, New: godoist.VERY_LOW, Reason: "no longer a next action"},
+		})
+		out := buf.String()
+		want := []string{
+			"Buy milk (1)",
+			"labels:   [home next] -> []",
+			"priority: High -> Very Low",
+			"Call Bob (2)",
+			"3 change(s) on 2 item(s).",
+		}
+		for _, w := range want {
+			if !strings.Contains(out, w) {
+				t.Errorf("output missing %q:\n%s", w, out)
+			}
+		}
+		if strings.Index(out, "priority: High") > strings.Index(out, "Call Bob") {
+			t.Errorf("changes for the same task should be grouped:\n%s", out)
+		}
+	})
+}
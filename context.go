@@ -7,8 +7,9 @@ import (
 )
 
 type taskContext struct {
-	Labels   []string               `json:"labels"`
-	Priority godoist.PRIORITY_LEVEL `json:"priority"`
+	Labels      []string               `json:"labels"`
+	Priority    godoist.PRIORITY_LEVEL `json:"priority"`
+	HasPriority bool                   `json:"-"`
 }
 
 func toSet(items []string) map[string]bool {
@@ -19,13 +20,23 @@ func toSet(items []string) map[string]bool {
 	return s
 }
 
-// computeRetainedLabels returns only the labels from ignoreLabels that exist on the task.
-// These are labels that should be kept when stripping everything else.
-func computeRetainedLabels(task *godoist.Task, ignoreLabels []string) []string {
-	ignoreSet := toSet(ignoreLabels)
+// sortedKeys returns the members of a set in sorted order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// computeRetainedLabels returns the task's labels without those in strip.
+// Labels in keep are always retained, even if they are also in strip.
+func computeRetainedLabels(task *godoist.Task, strip, keep []string) []string {
+	stripSet, keepSet := toSet(strip), toSet(keep)
 	retained := []string{}
 	for _, label := range task.Labels {
-		if ignoreSet[label] {
+		if keepSet[label] || !stripSet[label] {
 			retained = append(retained, label)
 		}
 	}
@@ -91,50 +102,93 @@ func hasCustomizations(task *godoist.Task, defaultLabels []string, defaultPriori
 	return false
 }
 
-// saveContext saves the task's current context-tracked labels and priority as a context comment.
-func saveContext(task *godoist.Task, contextLabels []string) error {
-	labels := computeSaveableLabels(task, contextLabels)
-	ctx := map[string]interface{}{
+// addedLabelsKey is the context key listing the labels automadoist added to a
+// task when it became a next action.
+const addedLabelsKey = "added_labels"
+
+// contextMap builds the comment payload for a saved context.
+func contextMap(labels []string, priority godoist.PRIORITY_LEVEL) map[string]interface{} {
+	return map[string]interface{}{
 		"labels":   labels,
-		"priority": int(task.Priority),
+		"priority": int(priority),
 	}
-	return task.SetContext(ctx)
 }
 
-// restoreContext reads and parses the saved context comment. Returns nil if none exists.
-func restoreContext(task *godoist.Task) (*taskContext, error) {
-	ctx, err := task.GetContext()
-	if err != nil {
-		return nil, err
-	}
-	if len(ctx) == 0 {
-		return nil, nil
+// savedContext extracts the saved labels and priority from a context comment.
+// Returns nil if none were saved.
+func savedContext(ctx map[string]interface{}) *taskContext {
+	labelsRaw, hasLabels := ctx["labels"]
+	priorityRaw, hasPriority := ctx["priority"]
+	if !hasLabels && !hasPriority {
+		return nil
 	}
-
 	tc := &taskContext{
 		Priority: godoist.VERY_LOW,
 	}
+	if hasLabels {
+		tc.Labels = labelsValue(labelsRaw)
+	}
+	if hasPriority {
+		tc.Priority = priorityValue(priorityRaw)
+		tc.HasPriority = true
+	}
+	return tc
+}
 
-	if labelsRaw, ok := ctx["labels"]; ok {
-		if labelsSlice, ok := labelsRaw.([]interface{}); ok {
-			for _, l := range labelsSlice {
-				if s, ok := l.(string); ok {
-					tc.Labels = append(tc.Labels, s)
-				}
+// setPriorityKey is the context key holding the priority automadoist last set
+// on a task.
+const setPriorityKey = "set_priority"
+
+// ownsPriority reports whether the task's current priority was set by
+// automadoist and may be reverted. A priority changed by hand since then is
+// the user's. Without a record, a priority matching the project's color
+// default is assumed to be automadoist's.
+func ownsPriority(ctx map[string]interface{}, current, colorDefault godoist.PRIORITY_LEVEL) bool {
+	if raw, ok := ctx[setPriorityKey]; ok {
+		return priorityValue(raw) == current
+	}
+	return current == colorDefault
+}
+
+// recordAddedLabels sets the added_labels update for a task gaining the
+// managed label: the labels added now, other than the managed labels which are
+// always stripped, plus earlier records for labels still on the task. Without
+// a record the project's default tags are stripped, so none is written when
+// that fallback gives the same result.
+func recordAddedLabels(updates, ctx map[string]interface{}, before, after map[string]bool, managed, defaultTags []string) {
+	managedSet := toSet(managed)
+	added := map[string]bool{}
+	if prev, ok := addedLabels(ctx); ok {
+		for _, label := range prev {
+			if before[label] {
+				added[label] = true
 			}
 		}
 	}
-
-	if priorityRaw, ok := ctx["priority"]; ok {
-		switch p := priorityRaw.(type) {
-		case float64:
-			tc.Priority = godoist.PRIORITY_LEVEL(int(p))
-		case int:
-			tc.Priority = godoist.PRIORITY_LEVEL(p)
+	for label := range after {
+		if !before[label] && !managedSet[label] {
+			added[label] = true
 		}
 	}
+	needed := len(added) > 0
+	for _, tag := range defaultTags {
+		needed = needed || before[tag]
+	}
+	if needed {
+		updates[addedLabelsKey] = sortedKeys(added)
+	} else {
+		updates[addedLabelsKey] = nil
+	}
+}
 
-	return tc, nil
+// addedLabels returns the labels automadoist recorded as added to the task.
+// ok is false for tasks labeled before provenance was recorded.
+func addedLabels(ctx map[string]interface{}) (labels []string, ok bool) {
+	raw, ok := ctx[addedLabelsKey]
+	if !ok {
+		return nil, false
+	}
+	return labelsValue(raw), true
 }
 
 // buildProjectMaps precomputes project tags and color lookup maps from a project list.
@@ -31,21 +31,22 @@ func TestToSet(t *testing.T) {
 
 func TestComputeRetainedLabels(t *testing.T) {
 	tests := []struct {
-		name         string
-		taskLabels   []string
-		ignoreLabels []string
-		want         []string
+		name       string
+		taskLabels []string
+		strip      []string
+		keep       []string
+		want       []string
 	}{
-		{"no labels", nil, []string{"waiting"}, []string{}},
-		{"no ignore labels", []string{"next", "home"}, nil, []string{}},
-		{"retains matching ignore labels", []string{"next", "waiting", "home"}, []string{"waiting", "review"}, []string{"waiting"}},
-		{"retains all matching", []string{"waiting", "review"}, []string{"waiting", "review"}, []string{"waiting", "review"}},
-		{"no overlap", []string{"next", "home"}, []string{"waiting", "review"}, []string{}},
+		{"no labels", nil, []string{"next"}, []string{"waiting"}, []string{}},
+		{"nothing to strip", []string{"next", "home"}, nil, nil, []string{"next", "home"}},
+		{"strips only listed labels", []string{"next", "phone", "home"}, []string{"next", "home"}, nil, []string{"phone"}},
+		{"keep wins over strip", []string{"next", "waiting"}, []string{"next", "waiting"}, []string{"waiting"}, []string{"waiting"}},
+		{"keeps unlisted labels", []string{"waiting", "errand"}, []string{"next"}, []string{"waiting"}, []string{"waiting", "errand"}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			task := &godoist.Task{Labels: tt.taskLabels}
-			got := computeRetainedLabels(task, tt.ignoreLabels)
+			got := computeRetainedLabels(task, tt.strip, tt.keep)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("computeRetainedLabels() = %v, want %v", got, tt.want)
 			}
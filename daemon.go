@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/urfave/cli/v2"
+)
+
+type DaemonConfig struct {
+	Pipelines  []string      `koanf:"pipelines"`
+	Schedule   string        `koanf:"schedule"`
+	Interval   time.Duration `koanf:"interval"`
+	Jitter     time.Duration `koanf:"jitter"`
+	Backoff    time.Duration `koanf:"backoff"`
+	MaxBackoff time.Duration `koanf:"max_backoff"`
+}
+
+// daemonFlags override the daemon section of the configuration.
+var daemonFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "schedule",
+		Usage: "Cron expression for runs, e.g. \"*/15 * * * *\" (overrides interval)",
+	},
+	&cli.DurationFlag{
+		Name:  "interval",
+		Usage: "Time between runs",
+	},
+	&cli.StringSliceFlag{
+		Name:  "pipelines",
+		Usage: "Pipelines to run, in order",
+	},
+}
+
+// applyFlags copies the daemonFlags that were set on the command line. The
+// koanf flag provider keys them by command path, so they do not reach the
+// daemon section on their own.
+func (d *DaemonConfig) applyFlags(c *cli.Context) {
+	if c.IsSet("schedule") {
+		d.Schedule = c.String("schedule")
+	}
+	if c.IsSet("interval") {
+		d.Interval = c.Duration("interval")
+	}
+	if c.IsSet("pipelines") {
+		d.Pipelines = c.StringSlice("pipelines")
+	}
+}
+
+func defaultDaemonConfig() DaemonConfig {
+	return DaemonConfig{
+		Pipelines:  []string{"next_items"},
+		Interval:   15 * time.Minute,
+		Jitter:     30 * time.Second,
+		Backoff:    time.Minute,
+		MaxBackoff: time.Hour,
+	}
+}
+
+func (c DaemonConfig) verify() error {
+	if err := verifyPipelines(c.Pipelines); err != nil {
+		return err
+	}
+	if _, err := c.schedule(); err != nil {
+		return err
+	}
+	if c.Jitter < 0 || c.Backoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("jitter, backoff and max_backoff must not be negative")
+	}
+	return nil
+}
+
+// schedule returns the run schedule: the cron expression if set, the interval otherwise.
+func (c DaemonConfig) schedule() (cron.Schedule, error) {
+	if c.Schedule != "" {
+		s, err := cron.ParseStandard(c.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("schedule: %w", err)
+		}
+		return s, nil
+	}
+	if c.Interval <= 0 {
+		return nil, fmt.Errorf("either schedule or a positive interval is required")
+	}
+	return cron.Every(c.Interval), nil
+}
+
+// backoffDelay returns how long to wait after the given number of consecutive failures.
+func (c DaemonConfig) backoffDelay(failures int) time.Duration {
+	if failures <= 0 || c.Backoff <= 0 {
+		return 0
+	}
+	delay := c.Backoff
+	for i := 1; i < failures && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if c.MaxBackoff > 0 && delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	return delay
+}
+
+// nextDelay computes the wait before the next run. After failures the wait is
+// stretched to the back-off delay if that is longer than the regular schedule.
+func (c DaemonConfig) nextDelay(sched cron.Schedule, now time.Time, failures int, rng *rand.Rand) time.Duration {
+	delay := sched.Next(now).Sub(now)
+	if backoff := c.backoffDelay(failures); backoff > delay {
+		delay = backoff
+	}
+	if c.Jitter > 0 {
+		delay += time.Duration(rng.Int63n(int64(c.Jitter)))
+	}
+	return delay
+}
+
+// runDaemon calls run once immediately and then on the configured schedule
+// until ctx is cancelled. A run in progress is always allowed to finish, so
+// cancellation never interrupts a half-applied set of changes.
+func runDaemon(ctx context.Context, cfg DaemonConfig, run func() error) error {
+	sched, err := cfg.schedule()
+	if err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	failures := 0
+	for ctx.Err() == nil {
+		start := time.Now()
+		if err := run(); err != nil {
+			failures++
+			logger.Error("Run failed", "error", err, "failures", failures)
+		} else {
+			failures = 0
+			logger.Info("Run finished", "duration", time.Since(start))
+		}
+
+		delay := cfg.nextDelay(sched, time.Now(), failures, rng)
+		logger.Info("Next run scheduled", "in", delay.Round(time.Second), "failures", failures)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+	logger.Info("Daemon stopped")
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestDaemonConfigVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     DaemonConfig
+		wantErr bool
+	}{
+		{"defaults", defaultDaemonConfig(), false},
+		{"cron schedule", DaemonConfig{Pipelines: []string{"reviews"}, Schedule: "*/5 * * * *"}, false},
+		{"invalid schedule", DaemonConfig{Pipelines: []string{"reviews"}, Schedule: "every now and then"}, true},
+		{"no schedule or interval", DaemonConfig{Pipelines: []string{"reviews"}}, true},
+		{"negative jitter", DaemonConfig{Pipelines: []string{"reviews"}, Interval: time.Minute, Jitter: -time.Second}, true},
+		{"unknown pipeline", DaemonConfig{Pipelines: []string{"cleanup"}, Interval: time.Minute}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.verify(); (err != nil) != tt.wantErr {
+				t.Errorf("verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	cfg := DaemonConfig{Backoff: time.Minute, MaxBackoff: 5 * time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := cfg.backoffDelay(tt.failures); got != tt.want {
+			t.Errorf("backoffDelay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	cfg := DaemonConfig{Interval: 10 * time.Minute, Jitter: time.Minute, Backoff: time.Hour, MaxBackoff: time.Hour}
+	sched, err := cfg.schedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 100; i++ {
+		d := cfg.nextDelay(sched, now, 0, rng)
+		if d < 10*time.Minute || d >= 11*time.Minute {
+			t.Fatalf("delay without failures = %v, want in [10m, 11m)", d)
+		}
+	}
+	if d := cfg.nextDelay(sched, now, 1, rng); d < time.Hour {
+		t.Errorf("delay after failure = %v, want at least the 1h back-off", d)
+	}
+
+	cfg = DaemonConfig{Schedule: "0 * * * *"}
+	sched, _ = cfg.schedule()
+	if d := cfg.nextDelay(sched, now.Add(45*time.Minute), 0, rng); d != 15*time.Minute {
+		t.Errorf("cron delay = %v, want 15m", d)
+	}
+}
+
+func TestRunDaemonStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := DaemonConfig{Interval: time.Millisecond, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	runs := 0
+	done := make(chan error)
+	go func() {
+		done <- runDaemon(ctx, cfg, func() error {
+			runs++
+			if runs == 3 {
+				cancel()
+			}
+			return errors.New("boom")
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runDaemon() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runDaemon did not stop after cancel")
+	}
+	if runs != 3 {
+		t.Errorf("runs = %d, want 3", runs)
+	}
+}
+
+func TestDaemonFlags(t *testing.T) {
+	run := func(args ...string) DaemonConfig {
+		t.Helper()
+		cfg := defaultDaemonConfig()
+		app := &cli.App{Commands: []*cli.Command{{
+			Name:   "daemon",
+			Flags:  daemonFlags,
+			Action: func(c *cli.Context) error { cfg.applyFlags(c); return nil },
+		}}}
+		if err := app.Run(append([]string{"automadoist", "daemon"}, args...)); err != nil {
+			t.Fatalf("Run(%q): %v", args, err)
+		}
+		return cfg
+	}
+
+	cfg := run("--schedule", "*/5 * * * *", "--interval", "5m", "--pipelines", "reviews", "--pipelines", "next_items")
+	if cfg.Schedule != "*/5 * * * *" || cfg.Interval != 5*time.Minute {
+		t.Errorf("schedule, interval = %q, %v, want the flag values", cfg.Schedule, cfg.Interval)
+	}
+	if len(cfg.Pipelines) != 2 || cfg.Pipelines[0] != "reviews" || cfg.Pipelines[1] != "next_items" {
+		t.Errorf("pipelines = %v, want [reviews next_items]", cfg.Pipelines)
+	}
+
+	// Flags that are not given leave the configuration alone.
+	if cfg := run(); cfg.Interval != defaultDaemonConfig().Interval || len(cfg.Pipelines) != 1 {
+		t.Errorf("config without flags = %+v, want defaults", cfg)
+	}
+}
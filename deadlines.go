@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+// parseDuration extends time.ParseDuration with whole days ("3d") and weeks
+// ("2w"), which is how schedules are usually written.
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for _, u := range []struct {
+		suffix string
+		unit   time.Duration
+	}{{"d", 24 * time.Hour}, {"w", 7 * 24 * time.Hour}} {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(count) * u.unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// dateFilter is the parsed skip_deadline setting, a comma-separated list of:
+//
+//	not_overdue             skip tasks whose deadline is in the future
+//	hide_future_due         skip tasks due after today
+//	due_within:3d           skip tasks due later than the window
+//	surface_overdue_always  overdue tasks are next actions even when blocked
+//	                        by a sequential parent, section or project
+type dateFilter struct {
+	notOverdue     bool
+	hideFutureDue  bool
+	dueWithin      time.Duration
+	surfaceOverdue bool
+}
+
+func parseSkipDeadline(s string) (dateFilter, error) {
+	var f dateFilter
+	for _, mode := range strings.Split(s, ",") {
+		mode = strings.TrimSpace(mode)
+		switch {
+		case mode == "":
+		case mode == "not_overdue":
+			f.notOverdue = true
+		case mode == "hide_future_due":
+			f.hideFutureDue = true
+		case mode == "surface_overdue_always":
+			f.surfaceOverdue = true
+		case strings.HasPrefix(mode, "due_within:"):
+			d, err := parseDuration(strings.TrimPrefix(mode, "due_within:"))
+			if err != nil {
+				return dateFilter{}, err
+			}
+			if d == 0 {
+				return dateFilter{}, fmt.Errorf("due_within needs a positive window")
+			}
+			f.dueWithin = d
+		default:
+			return dateFilter{}, fmt.Errorf("unknown skip_deadline mode %q", mode)
+		}
+	}
+	return f, nil
+}
+
+// dueDate returns when the task is due in local time and whether it has a
+// time of day.
+func dueDate(task *godoist.Task) (time.Time, bool, bool) {
+	if task.Due == nil || task.Due.Date == "" {
+		return time.Time{}, false, false
+	}
+	due, err := parseDeferDate(task.Due.Date)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	return due, len(task.Due.Date) > len(deferLayout), true
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// skip reports whether the task is filtered out by its deadline or due date.
+func (f dateFilter) skip(task *godoist.Task, now time.Time) bool {
+	if f.notOverdue && task.Deadline != nil && task.Deadline.ParsedDate.After(now) {
+		return true
+	}
+	due, _, ok := dueDate(task)
+	if !ok {
+		return false
+	}
+	if f.hideFutureDue && startOfDay(due).After(startOfDay(now)) {
+		return true
+	}
+	return f.dueWithin > 0 && due.After(now.Add(f.dueWithin))
+}
+
+// overdue reports whether the task's due date or deadline has passed.
+func (f dateFilter) overdue(task *godoist.Task, now time.Time) bool {
+	today := startOfDay(now)
+	if task.Deadline != nil && task.Deadline.Date != "" {
+		if deadline, err := time.ParseInLocation(deferLayout, task.Deadline.Date, now.Location()); err == nil && deadline.Before(today) {
+			return true
+		}
+	}
+	due, timed, ok := dueDate(task)
+	if !ok {
+		return false
+	}
+	if timed {
+		return due.Before(now)
+	}
+	return due.Before(today)
+}
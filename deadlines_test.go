@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"3d", 72 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"36h", 36 * time.Hour, false},
+		{"0d", 0, false},
+		{"d", 0, true},
+		{"-1d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseSkipDeadline(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    dateFilter
+		wantErr bool
+	}{
+		{"", dateFilter{}, false},
+		{"not_overdue", dateFilter{notOverdue: true}, false},
+		{"hide_future_due, surface_overdue_always", dateFilter{hideFutureDue: true, surfaceOverdue: true}, false},
+		{"not_overdue,due_within:3d", dateFilter{notOverdue: true, dueWithin: 72 * time.Hour}, false},
+		{"due_within:0d", dateFilter{}, true},
+		{"due_within:soon", dateFilter{}, true},
+		{"sometimes", dateFilter{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSkipDeadline(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSkipDeadline(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDateFilter(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local)
+	due := func(date string) *godoist.Task { return &godoist.Task{Due: &godoist.Due{Date: date}} }
+	// Due dates with a fixed timezone come as RFC 3339 with Z or an offset.
+	fixed := func(d time.Duration, zone *time.Location) *godoist.Task {
+		return due(now.Add(d).In(zone).Format(time.RFC3339))
+	}
+	plusTwo := time.FixedZone("+02:00", 2*60*60)
+	tests := []struct {
+		name        string
+		filter      string
+		task        *godoist.Task
+		wantSkip    bool
+		wantOverdue bool
+	}{
+		{"no dates", "hide_future_due,due_within:3d", &godoist.Task{}, false, false},
+		{"due today", "hide_future_due", due("2026-10-17"), false, false},
+		{"due later today", "hide_future_due", due("2026-10-17T18:00:00"), false, false},
+		{"due tomorrow", "hide_future_due", due("2026-10-18"), true, false},
+		{"due next week, hide disabled", "", due("2026-10-24"), false, false},
+		{"due within window", "due_within:3d", due("2026-10-20"), false, false},
+		{"due after window", "due_within:3d", due("2026-10-21"), true, false},
+		{"due yesterday", "hide_future_due", due("2026-10-16"), false, true},
+		{"due earlier today", "", due("2026-10-17T09:00:00"), false, true},
+		{"deadline passed", "", &godoist.Task{Deadline: &godoist.Deadline{Date: "2026-10-01"}}, false, true},
+		{"fixed timezone due tomorrow", "hide_future_due", fixed(24*time.Hour, time.UTC), true, false},
+		{"fixed timezone due after window", "due_within:1d", fixed(48*time.Hour, plusTwo), true, false},
+		{"fixed timezone due within window", "due_within:1d", fixed(time.Hour, plusTwo), false, false},
+		{"fixed timezone due earlier today", "", fixed(-3*time.Hour, time.UTC), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseSkipDeadline(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.skip(tt.task, now); got != tt.wantSkip {
+				t.Errorf("skip = %v, want %v", got, tt.wantSkip)
+			}
+			if got := f.overdue(tt.task, now); got != tt.wantOverdue {
+				t.Errorf("overdue = %v, want %v", got, tt.wantOverdue)
+			}
+		})
+	}
+}
+
+func TestSurfaceOverdueAlways(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"not_overdue", []string{"c3"}},
+		{"not_overdue,surface_overdue_always", []string{"c3", "c1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			store := newMemoryStore(
+				[]godoist.Project{{ID: "root", Name: "projects"}},
+				[]godoist.Task{
+					{ID: "p", Content: "Checklist !", ProjectID: "root"},
+					{ID: "c1", Content: "Overdue step", ProjectID: "root", ParentID: "p", ChildOrder: 1, Due: &godoist.Due{Date: "2000-01-01"}},
+					{ID: "c2", Content: "Step 2", ProjectID: "root", ParentID: "p", ChildOrder: 2},
+					{ID: "c3", Content: "Step 3", ProjectID: "root", ParentID: "p", ChildOrder: 3},
+					{ID: "d", Content: "Later", ProjectID: "root", Description: "[automadoist:defer=2999-01-01]"},
+					{ID: "d1", Content: "Deferred overdue", ProjectID: "root", ParentID: "d", Due: &godoist.Due{Date: "2000-01-01"}},
+				},
+			)
+			cfg := defaultNextItemsConfig()
+			cfg.SkipDeadline = tt.filter
+
+			var ids []string
+			for _, task := range getNextTasks(store, *store.Project("root"), cfg) {
+				ids = append(ids, task.ID)
+			}
+			if !sameLabels(ids, tt.want) {
+				t.Errorf("next tasks = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
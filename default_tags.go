@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"regexp"
 	"sort"
 	"strings"
 
@@ -14,43 +13,22 @@ type DefaultTagsConfig struct {
 	AvailableTags []string `koanf:"available_tags"`
 }
 
-var defaultTagsRegex = regexp.MustCompile(`\[automadoist:tags=([^\]]+)\]`)
-
+// parseDefaultTags returns the project's default tags from its
+// "[automadoist:tags=...]" marker.
 func parseDefaultTags(description string) []string {
-	match := defaultTagsRegex.FindStringSubmatch(description)
-	if match == nil {
-		return nil
-	}
-	raw := strings.Split(match[1], ",")
-	tags := make([]string, 0, len(raw))
-	for _, t := range raw {
-		t = strings.TrimSpace(t)
-		if t != "" {
-			tags = append(tags, t)
-		}
-	}
-	return tags
+	return parseMetadata(description).list("tags")
 }
 
+// setDefaultTagsInDescription rewrites the tags marker, leaving the rest of
+// the description untouched. No tags removes the marker.
 func setDefaultTagsInDescription(description string, tags []string) string {
-	marker := ""
+	m := parseMetadata(description)
 	if len(tags) > 0 {
-		marker = "[automadoist:tags=" + strings.Join(tags, ",") + "]"
+		m.setList("tags", tags)
+	} else {
+		m.remove("tags")
 	}
-
-	if defaultTagsRegex.MatchString(description) {
-		replaced := defaultTagsRegex.ReplaceAllString(description, marker)
-		return strings.TrimSpace(replaced)
-	}
-
-	if marker == "" {
-		return description
-	}
-
-	if description == "" {
-		return marker
-	}
-	return description + "\n" + marker
+	return m.String()
 }
 
 func buildProjectTagsMap(projects []godoist.Project) map[string][]string {
@@ -64,6 +42,13 @@ func buildProjectTagsMap(projects []godoist.Project) map[string][]string {
 	return projectTags
 }
 
+// sortByChildOrder sorts sibling projects as they appear in Todoist.
+func sortByChildOrder(siblings []*godoist.Project) {
+	sort.Slice(siblings, func(i, j int) bool {
+		return siblings[i].ChildOrder < siblings[j].ChildOrder
+	})
+}
+
 // sortProjectsByOrder sorts projects into a stable tree order matching
 // Todoist's sidebar: depth-first traversal ordered by ChildOrder at each level.
 func sortProjectsByOrder(projects []*godoist.Project) {
@@ -72,9 +57,7 @@ func sortProjectsByOrder(projects []*godoist.Project) {
 		childrenOf[p.ParentID] = append(childrenOf[p.ParentID], p)
 	}
 	for _, children := range childrenOf {
-		sort.Slice(children, func(i, j int) bool {
-			return children[i].ChildOrder < children[j].ChildOrder
-		})
+		sortByChildOrder(children)
 	}
 
 	ordered := make([]*godoist.Project, 0, len(projects))
@@ -102,12 +85,24 @@ func sortProjectsByOrder(projects []*godoist.Project) {
 	copy(projects, ordered)
 }
 
-func defaultTagsCommand(client *godoist.Todoist, cfg DefaultTagsConfig) error {
+// applyDefaultTags writes the project's default tags marker and commits the change.
+func applyDefaultTags(store taskStore, cs *changeSet, project *godoist.Project, tags []string) error {
+	newDescription := setDefaultTagsInDescription(project.Description, tags)
+	if err := cs.setProjectDescription(project, newDescription, "default tags"); err != nil {
+		return fmt.Errorf("updating project description: %w", err)
+	}
+	if err := store.Commit(); err != nil {
+		return fmt.Errorf("committing changes: %w", err)
+	}
+	return nil
+}
+
+func defaultTagsCommand(store taskStore, cfg DefaultTagsConfig, cs *changeSet) error {
 	if len(cfg.AvailableTags) == 0 {
 		return fmt.Errorf("no available tags configured; set default_tags.available_tags in config")
 	}
 
-	allProjects := client.Projects.All()
+	allProjects := store.Projects()
 	if len(allProjects) == 0 {
 		return fmt.Errorf("no projects found")
 	}
@@ -138,7 +133,7 @@ func defaultTagsCommand(client *godoist.Todoist, cfg DefaultTagsConfig) error {
 			return nil
 		}
 
-		project := client.Projects.Get(projectID)
+		project := store.Project(projectID)
 		if project == nil {
 			return fmt.Errorf("project not found: %s", projectID)
 		}
@@ -167,12 +162,8 @@ func defaultTagsCommand(client *godoist.Todoist, cfg DefaultTagsConfig) error {
 			return nil
 		}
 
-		newDescription := setDefaultTagsInDescription(project.Description, selectedTags)
-		if err := project.Update("description", newDescription); err != nil {
-			return fmt.Errorf("updating project description: %w", err)
-		}
-		if err := client.Commit(); err != nil {
-			return fmt.Errorf("committing changes: %w", err)
+		if err := applyDefaultTags(store, cs, project, selectedTags); err != nil {
+			return err
 		}
 
 		if len(selectedTags) > 0 {
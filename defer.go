@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+// deferLayout is the date format of "[automadoist:defer=2026-11-01]". A time
+// of day may follow as in Todoist due dates, e.g. "2026-11-01T09:00:00", or
+// "2026-11-01T09:00:00Z" for due dates with a fixed timezone.
+const deferLayout = "2006-01-02"
+
+// parseDeferDate parses a start date in local time.
+func parseDeferDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(time.Local), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(deferLayout, value, time.Local)
+}
+
+func validateDeferValue(value string) error {
+	_, err := parseDeferDate(value)
+	return err
+}
+
+// deferDate returns the start date from a defer marker, if any.
+func deferDate(m *metadata) (time.Time, bool) {
+	value, ok := m.get("defer")
+	if !ok {
+		return time.Time{}, false
+	}
+	until, err := parseDeferDate(value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// taskDeferred reports whether a task may not be started before a later date,
+// either by a defer marker in its description or, when cfg.DeferLabel is set,
+// by carrying that label and a due date.
+func taskDeferred(task *godoist.Task, cfg NextItemsConfig, now time.Time) bool {
+	if until, ok := deferDate(parseMetadata(task.Description)); ok && now.Before(until) {
+		return true
+	}
+	if cfg.DeferLabel == "" || task.Due == nil || !hasLabel([]string{cfg.DeferLabel}, task) {
+		return false
+	}
+	until, err := parseDeferDate(task.Due.Date)
+	return err == nil && now.Before(until)
+}
+
+// projectDeferred reports whether a project or one of its parents is deferred.
+func projectDeferred(store taskStore, project *godoist.Project, now time.Time) bool {
+	for p := project; p != nil; p = store.Project(p.ParentID) {
+		if until, ok := deferDate(parseMetadata(p.Description)); ok && now.Before(until) {
+			return true
+		}
+		if p.ParentID == "" {
+			break
+		}
+	}
+	return false
+}
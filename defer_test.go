@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestDeferredTasks(t *testing.T) {
+	const future, past = "[automadoist:defer=2999-01-01]", "[automadoist:defer=2000-01-01]"
+	tests := []struct {
+		name    string
+		project string
+		parent  string
+		task    string
+		label   string
+		due     string
+		want    []string
+	}{
+		{"not deferred", "", "", "", "", "", []string{"leaf", "child"}},
+		{"task deferred", "", "", future, "", "", []string{"child"}},
+		{"defer date passed", "", "", past, "", "", []string{"leaf", "child"}},
+		{"parent defers subtree", "", future, "", "", "", []string{"leaf"}},
+		{"project deferred", future, "", "", "", "", nil},
+		{"tickler label with future due date", "", "", "", "tickler", "2999-01-01", []string{"child"}},
+		{"tickler label with due date passed", "", "", "", "tickler", "2000-01-01T09:00:00", []string{"leaf", "child"}},
+		{"tickler label with fixed timezone due date", "", "", "", "tickler", "2999-01-01T09:00:00Z", []string{"child"}},
+		{"tickler label with offset due date passed", "", "", "", "tickler", "2000-01-01T09:00:00+02:00", []string{"leaf", "child"}},
+		{"due date without tickler label", "", "", "", "", "2999-01-01", []string{"leaf", "child"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leaf := godoist.Task{ID: "leaf", Content: "Leaf", ProjectID: "client", Description: tt.task}
+			if tt.label != "" {
+				leaf.Labels = []string{tt.label}
+			}
+			if tt.due != "" {
+				leaf.Due = &godoist.Due{Date: tt.due}
+			}
+			store := newMemoryStore(
+				[]godoist.Project{
+					{ID: "root", Name: "projects", Description: tt.project},
+					{ID: "client", Name: "Client", ParentID: "root"},
+				},
+				[]godoist.Task{
+					leaf,
+					{ID: "parent", Content: "Parent", ProjectID: "client", Description: tt.parent},
+					{ID: "child", Content: "Child", ProjectID: "client", ParentID: "parent"},
+				},
+			)
+			cfg := defaultNextItemsConfig()
+			cfg.DeferLabel = "tickler"
+
+			got := getNextTasks(store, *store.Project("client"), cfg)
+
+			var ids []string
+			for _, task := range got {
+				ids = append(ids, task.ID)
+			}
+			if !sameLabels(ids, tt.want) {
+				t.Errorf("next tasks = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/harlequix/godoist"
+)
+
+var taskIDRegex = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// blockerID extracts a task ID from a "blocked_by" item: a bare ID or a
+// Todoist task link such as "https://app.todoist.com/app/task/sign-off-6X7rM8997g3RQmvh"
+// or "todoist://task?id=6X7rM8997g3RQmvh".
+func blockerID(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if taskIDRegex.MatchString(ref) {
+		return ref, nil
+	}
+	u, err := url.Parse(ref)
+	if err == nil {
+		if id := u.Query().Get("id"); taskIDRegex.MatchString(id) {
+			return id, nil
+		}
+		if path := strings.TrimSuffix(u.Path, "/"); strings.Contains(path, "/task/") {
+			id := path[strings.LastIndex(path, "/")+1:]
+			id = id[strings.LastIndex(id, "-")+1:]
+			if taskIDRegex.MatchString(id) {
+				return id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("not a task ID or link: %q", ref)
+}
+
+func validateBlockedByValue(value string) error {
+	for _, ref := range strings.Split(value, ",") {
+		if strings.TrimSpace(ref) == "" {
+			continue
+		}
+		if _, err := blockerID(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taskBlocked reports whether a task waits for another open task, declared
+// with "[automadoist:blocked_by=<id or link>,...]" in its description.
+// Completed and deleted blockers no longer block.
+func taskBlocked(store taskStore, task *godoist.Task) bool {
+	for _, ref := range parseMetadata(task.Description).list("blocked_by") {
+		id, err := blockerID(ref)
+		if err != nil {
+			continue
+		}
+		if blocker := store.Task(id); blocker != nil && !blocker.Checked {
+			logger.Debug("Task blocked", "task", task.Content, "blocker", blocker.Content)
+			return true
+		}
+	}
+	return false
+}
+
+// dependentProjects returns the projects holding tasks with a blocked_by
+// marker. Completing a blocker in one project can unblock tasks in these.
+func dependentProjects(store taskStore) []string {
+	ids := map[string]bool{}
+	for _, task := range store.Tasks() {
+		if parseMetadata(task.Description).has("blocked_by") {
+			ids[task.ProjectID] = true
+		}
+	}
+	return sortedKeys(ids)
+}
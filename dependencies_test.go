@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestBlockerID(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"6X7rM8997g3RQmvh", "6X7rM8997g3RQmvh", false},
+		{" 123 ", "123", false},
+		{"https://app.todoist.com/app/task/legal-sign-off-6X7rM8997g3RQmvh", "6X7rM8997g3RQmvh", false},
+		{"https://todoist.com/showTask?id=123", "123", false},
+		{"todoist://task?id=6X7rM8997g3RQmvh", "6X7rM8997g3RQmvh", false},
+		{"legal sign-off", "", true},
+		{"https://example.com/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := blockerID(tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("blockerID(%q) = %q, %v; want %q, error %v", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestBlockedTasks(t *testing.T) {
+	store := newMemoryStore(
+		[]godoist.Project{
+			{ID: "root", Name: "projects"},
+			{ID: "legal", Name: "Legal", ParentID: "root"},
+			{ID: "ops", Name: "Ops", ParentID: "root"},
+		},
+		[]godoist.Task{
+			{ID: "signoff", Content: "Legal sign-off", ProjectID: "legal"},
+			{ID: "deploy", Content: "Deploy", ProjectID: "ops", Description: "[automadoist:blocked_by=https://app.todoist.com/app/task/legal-sign-off-signoff]"},
+			{ID: "release", Content: "Release", ProjectID: "ops", Description: "[automadoist:blocked_by=signoff]"},
+			{ID: "notes", Content: "Write notes", ProjectID: "ops", ParentID: "release"},
+			{ID: "monitor", Content: "Monitor", ProjectID: "ops", Description: "[automadoist:blocked_by=gone]"},
+		},
+	)
+	cfg := defaultNextItemsConfig()
+
+	next := func() []string {
+		var ids []string
+		for _, task := range store.Tasks() {
+			if hasLabel([]string{"next"}, task) {
+				ids = append(ids, task.ID)
+			}
+		}
+		return ids
+	}
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+	if got := next(); !sameLabels(got, []string{"signoff", "monitor"}) {
+		t.Errorf("next while blocked = %v", got)
+	}
+	if got := dependentProjects(store); !reflect.DeepEqual(got, []string{"ops"}) {
+		t.Errorf("dependentProjects() = %v", got)
+	}
+
+	// A completed blocker normally drops out of the sync; a checked one that
+	// is still around no longer blocks either.
+	store.Task("signoff").Checked = true
+	process_next_items(store, cfg, newChangeSet(store, false))
+	if got := next(); !sameLabels(got, []string{"signoff", "deploy", "notes", "monitor"}) {
+		t.Errorf("next after sign-off = %v", got)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harlequix/automadoist/internal/fakeapi"
+	"github.com/harlequix/godoist"
+)
+
+// startFake serves a fixture from testdata on a fake Todoist API and returns
+// a synced store talking to it over HTTP.
+func startFake(t *testing.T, fixture string) (*fakeapi.Server, taskStore) {
+	t.Helper()
+	f, err := fakeapi.LoadFixture(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("loading fixture: %v", err)
+	}
+	fake := fakeapi.New(f)
+	fake.Token = "test-token"
+	srv := fake.Start()
+	t.Cleanup(srv.Close)
+
+	oldURL := godoist.APIURL
+	godoist.APIURL = srv.URL
+	t.Cleanup(func() { godoist.APIURL = oldURL })
+
+	return fake, syncStore(t)
+}
+
+// syncStore returns a freshly synced store talking to the running fake.
+func syncStore(t *testing.T) taskStore {
+	t.Helper()
+	store := newTodoistStore("test-token")
+	if err := store.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	return store
+}
+
+func serverLabels(fake *fakeapi.Server, id string) []string {
+	return labelsValue(fake.Task(id)["labels"])
+}
+
+func TestEndToEndNextItems(t *testing.T) {
+	fake, store := startFake(t, "account.yaml")
+	cfg := defaultNextItemsConfig()
+	cfg.ColorPriority = map[string]int{"red": 3}
+	cfg.ContextLabels = []string{"errand"}
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	want := map[string][]string{
+		"1":  {"home", "next"},
+		"2":  {},
+		"3":  {"waiting"},
+		"5":  {},
+		"6":  {"home", "next"},
+		"8":  {"next"},
+		"9":  {},
+		"10": {},
+	}
+	for id, labels := range want {
+		if got := serverLabels(fake, id); !sameLabels(got, labels) {
+			t.Errorf("task %s labels = %v, want %v", id, got, labels)
+		}
+	}
+	if p := fake.Task("1")["priority"]; p != float64(3) {
+		t.Errorf("task 1 priority = %v, want 3 from project color", p)
+	}
+	if p := fake.Task("10")["priority"]; p != float64(4) {
+		t.Errorf("task 10 priority = %v, want hand-set 4 kept", p)
+	}
+	comments := fake.TaskComments("10")
+	if len(comments) != 1 || !strings.HasPrefix(comments[0], godoist.ContextPrefix) || !strings.Contains(comments[0], "errand") {
+		t.Errorf("task 10 comments = %v, want saved context with errand", comments)
+	}
+
+	// A second run against the resulting state is a no-op.
+	before := len(fake.Commands())
+	store = syncStore(t)
+	process_next_items(store, cfg, newChangeSet(store, false))
+	if after := len(fake.Commands()); after != before {
+		t.Errorf("second run sent %d commands, want none", after-before)
+	}
+}
+
+func TestEndToEndDryRunSendsNothing(t *testing.T) {
+	fake, store := startFake(t, "account.yaml")
+	cs := newChangeSet(store, true)
+
+	process_next_items(store, defaultNextItemsConfig(), cs)
+
+	if len(cs.Changes()) == 0 {
+		t.Error("expected planned changes")
+	}
+	if cmds := fake.Commands(); len(cmds) != 0 {
+		t.Errorf("dry run sent commands: %v", cmds)
+	}
+}
+
+func TestEndToEndReviews(t *testing.T) {
+	fake, store := startFake(t, "account.yaml")
+	cfg := defaultReviewsConfig(defaultNextItemsConfig())
+
+	reviews(store, cfg, newChangeSet(store, false))
+
+	if got := serverLabels(fake, "2"); !sameLabels(got, []string{"review"}) {
+		t.Errorf("review task labels = %v, want [review]", got)
+	}
+	for _, cmd := range fake.Commands() {
+		if cmd.Args["id"] != "2" {
+			t.Errorf("unexpected command %v", cmd)
+		}
+	}
+}
+
+func TestEndToEndDefaultTags(t *testing.T) {
+	fake, store := startFake(t, "account.yaml")
+	cs := newChangeSet(store, false)
+
+	if err := applyDefaultTags(store, cs, store.Project("home"), []string{"home", "errand"}); err != nil {
+		t.Fatalf("applyDefaultTags: %v", err)
+	}
+
+	if got := fake.Project("home")["description"]; got != "Chores\n[automadoist:tags=home,errand]" {
+		t.Errorf("description = %q", got)
+	}
+	cmds := fake.Commands()
+	if len(cmds) != 1 || cmds[0].Type != "project_update" {
+		t.Errorf("commands = %v, want one project_update", cmds)
+	}
+}
+
+func TestEndToEndStalledCreate(t *testing.T) {
+	_, store := startFake(t, "account.yaml")
+	cfg := defaultNextItemsConfig()
+	// Leaves Work without an actionable task: docs are skipped and the
+	// release has a future deadline.
+	cfg.SkipPrefixes = []string{"*", "Write"}
+	cfg.Stalled.Mode = "create"
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	var created []*godoist.Task
+	for _, task := range syncStore(t).Tasks() {
+		if task.Content == "Define next action" {
+			created = append(created, task)
+		}
+	}
+	if len(created) != 1 || created[0].ProjectID != "work" {
+		t.Fatalf("created = %v, want one task in work", created)
+	}
+}
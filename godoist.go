@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/harlequix/godoist"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/cliflagv2"
 	"github.com/knadh/koanf/providers/env"
@@ -18,9 +20,61 @@ import (
 
 type config struct {
 	Token         string            `koanf:"token"`
+	StateDir      string            `koanf:"state_dir"`
+	SyncCache     bool              `koanf:"sync_cache"`
 	NextItems     NextItemsConfig   `koanf:"next_items"`
 	ReviewsConfig ReviewsConfig     `koanf:"reviews"`
 	DefaultTags   DefaultTagsConfig `koanf:"default_tags"`
+	Daemon        DaemonConfig      `koanf:"daemon"`
+	Serve         ServeConfig       `koanf:"serve"`
+
+	// fullSync forces a full download instead of an incremental sync.
+	fullSync bool
+}
+
+// stateDir returns the directory for local state such as the undo journal.
+// It defaults to an automadoist directory in the user's cache directory.
+func (c config) stateDir() string {
+	if c.StateDir != "" {
+		return c.StateDir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "automadoist")
+	}
+	return ".automadoist"
+}
+
+func (c config) journalPath() string {
+	return filepath.Join(c.stateDir(), "journal.jsonl")
+}
+
+func (c config) syncCachePath() string {
+	return filepath.Join(c.stateDir(), "sync.json")
+}
+
+// openStore connects to the Todoist API and syncs the account, incrementally
+// if the sync cache is enabled. A requested full sync is only done once, so
+// later runs of a long-lived process go back to fetching deltas.
+func openStore(cfg *config) (taskStore, error) {
+	store := newTodoistStore(cfg.Token)
+	if cfg.SyncCache {
+		store = newCachedTodoistStore(cfg.Token, cfg.syncCachePath(), cfg.fullSync)
+		cfg.fullSync = false
+	}
+	if err := store.Sync(); err != nil {
+		return nil, err
+	}
+	warnInvalidMetadata(store)
+	return store, nil
+}
+
+// newRunChangeSet returns a change set for a command run. Live runs are recorded in the journal.
+func newRunChangeSet(store taskStore, cfg *config, dryRun bool) *changeSet {
+	cs := newChangeSet(store, dryRun)
+	if !dryRun {
+		cs.journal = newJournal(cfg.journalPath())
+	}
+	return cs
 }
 
 func (c config) Verify() error {
@@ -33,6 +87,18 @@ func (c config) Verify() error {
 	if err := c.ReviewsConfig.verify(); err != nil {
 		return fmt.Errorf("reviews: %w", err)
 	}
+	// The waiting and stale checks read the context comment of every
+	// candidate, which only the sync cache serves without a request per task.
+	if !c.SyncCache {
+		for _, nc := range []NextItemsConfig{c.NextItems, c.ReviewsConfig.NextItemsConfig} {
+			if nc.Waiting.Mode != "" {
+				return fmt.Errorf("next_items: waiting requires sync_cache")
+			}
+			if nc.Stale.Mode != "" {
+				return fmt.Errorf("next_items: stale requires sync_cache")
+			}
+		}
+	}
 	return nil
 }
 
@@ -40,9 +106,32 @@ func (c NextItemsConfig) verify() error {
 	if len(c.ManagedLabels) == 0 {
 		return fmt.Errorf("managed_labels must contain at least one label")
 	}
-	if c.EntryPoint == "" {
+	if c.EntryPoint == "" && len(c.Roots) == 0 {
 		return fmt.Errorf("entry_point must not be empty")
 	}
+	for _, r := range c.Roots {
+		if err := r.verify(); err != nil {
+			return fmt.Errorf("roots: %w", err)
+		}
+	}
+	if c.Depth < 0 {
+		return fmt.Errorf("depth must not be negative")
+	}
+	if _, err := parseSequentialOrder(c.SequentialOrder); err != nil {
+		return fmt.Errorf("sequential_order: %w", err)
+	}
+	if _, err := parseSkipDeadline(c.SkipDeadline); err != nil {
+		return fmt.Errorf("skip_deadline: %w", err)
+	}
+	if err := c.Stalled.verify(); err != nil {
+		return fmt.Errorf("stalled: %w", err)
+	}
+	if err := c.Waiting.verify(); err != nil {
+		return fmt.Errorf("waiting: %w", err)
+	}
+	if err := c.Stale.verify(); err != nil {
+		return fmt.Errorf("stale: %w", err)
+	}
 	if len(c.ManagedLabels) > 1 {
 		logger.Warn("managed_labels has multiple entries; the first label will be used as the primary label",
 			"primary", c.ManagedLabels[0],
@@ -53,9 +142,20 @@ func (c NextItemsConfig) verify() error {
 }
 
 func (c ReviewsConfig) verify() error {
-	if c.Label == "" {
+	if len(c.Rules) == 0 && c.Label == "" {
 		return fmt.Errorf("label must not be empty")
 	}
+	for i, rule := range c.Rules {
+		if rule.Label == "" {
+			return fmt.Errorf("rules[%d]: label must not be empty", i)
+		}
+		if len(rule.Prefixes) == 0 {
+			return fmt.Errorf("rules[%d]: prefixes must not be empty", i)
+		}
+		if rule.Priority < 0 || rule.Priority > 4 {
+			return fmt.Errorf("rules[%d]: priority must be between 1 and 4", i)
+		}
+	}
 	return nil
 }
 
@@ -76,8 +176,11 @@ func init() {
 
 var defaultConfig = config{
 	Token:         "",
+	SyncCache:     true,
 	NextItems:     defaultNextItemsConfig(),
 	ReviewsConfig: defaultReviewsConfig(NextItemsConfig{}),
+	Daemon:        defaultDaemonConfig(),
+	Serve:         defaultServeConfig(),
 }
 
 func ParseLevel(s string) (slog.Level, error) {
@@ -125,9 +228,18 @@ func getConfig(c *cli.Context) (*config, error) {
 	if err != nil {
 		return nil, err
 	}
+	cfg.fullSync = c.Bool("full-sync")
 	return &cfg, nil
 }
 
+const defaultPlanFile = "automadoist.plan.json"
+
+var dryRunFlag = &cli.BoolFlag{
+	Name:  "dry-run",
+	Usage: "Print the changes that would be made without applying them",
+	Value: false,
+}
+
 func main() {
 	start := time.Now()
 
@@ -153,6 +265,11 @@ func main() {
 				Usage:   "Todoist API token",
 				Value:   "",
 			},
+			&cli.BoolFlag{
+				Name:  "full-sync",
+				Usage: "Ignore the sync cache and download the whole account",
+				Value: false,
+			},
 			&cli.StringFlag{
 				Name:    "log-level",
 				Aliases: []string{"l"},
@@ -164,18 +281,14 @@ func main() {
 			{
 				Name:  "next_items",
 				Usage: "Manage next items in Todoist",
+				Flags: []cli.Flag{dryRunFlag},
 				Action: func(c *cli.Context) error {
 					cfg, err := getConfig(c)
 					if err != nil {
 						return err
 					}
 					logger.Debug("loaded and verified config", "config", cfg)
-					client := godoist.NewTodoist(cfg.Token)
-					if err := client.Sync(); err != nil {
-						return err
-					}
-					process_next_items(client, cfg.NextItems)
-					if err := client.Commit(); err != nil {
+					if err := runPipelines(cfg, []string{"next_items"}, c.Bool("dry-run")); err != nil {
 						return err
 					}
 					finish := time.Now()
@@ -191,35 +304,217 @@ func main() {
 					if err != nil {
 						return err
 					}
-					client := godoist.NewTodoist(cfg.Token)
-					if err := client.Sync(); err != nil {
+					store, err := openStore(cfg)
+					if err != nil {
 						return err
 					}
-					return defaultTagsCommand(client, cfg.DefaultTags)
+					return defaultTagsCommand(store, cfg.DefaultTags, newRunChangeSet(store, cfg, false))
 				},
 			},
 			{
 				Name:  "reviews",
 				Usage: "Manage review items in Todoist",
+				Flags: []cli.Flag{dryRunFlag},
 				Action: func(c *cli.Context) error {
 					cfg, err := getConfig(c)
 					if err != nil {
 						return err
 					}
 					logger.Debug("loaded and verified config", "config", cfg)
-					client := godoist.NewTodoist(cfg.Token)
-					if err := client.Sync(); err != nil {
+					if err := runPipelines(cfg, []string{"reviews"}, c.Bool("dry-run")); err != nil {
+						return err
+					}
+					finish := time.Now()
+					logger.Info("Finished", "duration", finish.Sub(start))
+					return nil
+				},
+			},
+			{
+				Name:      "run",
+				Usage:     "Run several pipelines on a single sync",
+				ArgsUsage: "[pipeline...]",
+				Flags:     []cli.Flag{dryRunFlag},
+				Action: func(c *cli.Context) error {
+					cfg, err := getConfig(c)
+					if err != nil {
 						return err
 					}
-					if cfg.ReviewsConfig.NextItemsConfig.EntryPoint == "" {
-						cfg.ReviewsConfig.NextItemsConfig = cfg.NextItems
+					pipelines := c.Args().Slice()
+					if len(pipelines) == 0 {
+						pipelines = pipelineNames
 					}
-					reviews(client, cfg.ReviewsConfig)
-					if err := client.Commit(); err != nil {
+					if err := verifyPipelines(pipelines); err != nil {
 						return err
 					}
-					finish := time.Now()
-					logger.Info("Finished", "duration", finish.Sub(start))
+					if err := runPipelines(cfg, pipelines, c.Bool("dry-run")); err != nil {
+						return err
+					}
+					logger.Info("Finished", "pipelines", pipelines, "duration", time.Since(start))
+					return nil
+				},
+			},
+			{
+				Name:  "daemon",
+				Usage: "Run the configured pipelines on a schedule until stopped",
+				Flags: daemonFlags,
+				Action: func(c *cli.Context) error {
+					cfg, err := getConfig(c)
+					if err != nil {
+						return err
+					}
+					cfg.Daemon.applyFlags(c)
+					if err := cfg.Daemon.verify(); err != nil {
+						return fmt.Errorf("daemon: %w", err)
+					}
+					ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					logger.Info("Starting daemon", "pipelines", cfg.Daemon.Pipelines, "schedule", cfg.Daemon.Schedule, "interval", cfg.Daemon.Interval)
+					return runDaemon(ctx, cfg.Daemon, func() error {
+						return runPipelines(cfg, cfg.Daemon.Pipelines, false)
+					})
+				},
+			},
+			{
+				Name:  "serve",
+				Usage: "Recompute next items when Todoist webhook events arrive",
+				Flags: serveFlags,
+				Action: func(c *cli.Context) error {
+					cfg, err := getConfig(c)
+					if err != nil {
+						return err
+					}
+					cfg.Serve.applyFlags(c)
+					if err := cfg.Serve.verify(); err != nil {
+						return fmt.Errorf("serve: %w", err)
+					}
+					ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					return serveWebhooks(ctx, cfg)
+				},
+			},
+			{
+				Name:      "plan",
+				Usage:     "Compute changes for the given pipelines and save them to a plan file",
+				ArgsUsage: "[pipeline...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "out",
+						Aliases: []string{"o"},
+						Usage:   "Path to write the plan file to",
+						Value:   defaultPlanFile,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					cfg, err := getConfig(c)
+					if err != nil {
+						return err
+					}
+					pipelines := c.Args().Slice()
+					if len(pipelines) == 0 {
+						pipelines = []string{"next_items"}
+					}
+					store, err := openStore(cfg)
+					if err != nil {
+						return err
+					}
+					before := snapshotTasks(store.Tasks())
+					projects := snapshotProjects(store.Projects())
+					cs := newChangeSet(store, true)
+					for _, name := range pipelines {
+						if err := runPipeline(name, store, cfg, cs); err != nil {
+							return err
+						}
+					}
+					p := newPlan(pipelines, before, projects, cs.Changes())
+					if err := writePlan(c.String("out"), p); err != nil {
+						return fmt.Errorf("writing plan: %w", err)
+					}
+					printChanges(os.Stdout, p.Changes)
+					fmt.Printf("Plan saved to %s\n", c.String("out"))
+					return nil
+				},
+			},
+			{
+				Name:      "apply",
+				Usage:     "Apply a plan file created by the plan command",
+				ArgsUsage: "[plan-file]",
+				Action: func(c *cli.Context) error {
+					cfg, err := getConfig(c)
+					if err != nil {
+						return err
+					}
+					path := c.Args().First()
+					if path == "" {
+						path = defaultPlanFile
+					}
+					p, err := readPlan(path)
+					if err != nil {
+						return err
+					}
+					store, err := openStore(cfg)
+					if err != nil {
+						return err
+					}
+					cs := newRunChangeSet(store, cfg, false)
+					if err := applyPlan(store, p, cs); err != nil {
+						return err
+					}
+					if err := store.Commit(); err != nil {
+						return err
+					}
+					fmt.Printf("Applied %d change(s) from %s\n", len(cs.Changes()), path)
+					return nil
+				},
+			},
+			{
+				Name:      "undo",
+				Usage:     "Restore the values changed by a previous run (default: the most recent run)",
+				ArgsUsage: "[run-id]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Restore values even if they were changed after the run",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:  "list",
+						Usage: "List recorded runs instead of undoing one",
+						Value: false,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					cfg, err := getConfig(c)
+					if err != nil {
+						return err
+					}
+					entries, err := readJournal(cfg.journalPath())
+					if err != nil {
+						return fmt.Errorf("reading journal: %w", err)
+					}
+					if c.Bool("list") {
+						printRuns(os.Stdout, entries)
+						return nil
+					}
+					runID, runChanges := runEntries(entries, c.Args().First())
+					if len(runChanges) == 0 {
+						return fmt.Errorf("no journal entries found for run %q in %s", runID, cfg.journalPath())
+					}
+					store, err := openStore(cfg)
+					if err != nil {
+						return err
+					}
+					cs := newRunChangeSet(store, cfg, false)
+					skipped, err := undoRun(store, runID, runChanges, cs, c.Bool("force"))
+					for _, s := range skipped {
+						fmt.Printf("Skipped %s\n", s)
+					}
+					if err != nil {
+						return err
+					}
+					if err := store.Commit(); err != nil {
+						return err
+					}
+					fmt.Printf("Restored %d change(s) from run %s\n", len(cs.Changes()), runID)
 					return nil
 				},
 			},
@@ -57,4 +57,38 @@ func TestConfigVerify(t *testing.T) {
 			t.Error("expected error for empty review label")
 		}
 	})
+	t.Run("review rule without prefixes", func(t *testing.T) {
+		reviews := defaultReviewsConfig(NextItemsConfig{})
+		reviews.Rules = []ReviewRule{{Prefixes: []string{"*"}, Label: "review"}, {Label: "decide"}}
+		cfg := config{Token: "abc123", NextItems: defaultNextItemsConfig(), ReviewsConfig: reviews}
+		if err := cfg.Verify(); err == nil {
+			t.Error("expected error for review rule without prefixes")
+		}
+	})
+	t.Run("review rule priority out of range", func(t *testing.T) {
+		reviews := defaultReviewsConfig(NextItemsConfig{})
+		reviews.Rules = []ReviewRule{{Prefixes: []string{"?"}, Label: "decide", Priority: 5}}
+		cfg := config{Token: "abc123", NextItems: defaultNextItemsConfig(), ReviewsConfig: reviews}
+		if err := cfg.Verify(); err == nil {
+			t.Error("expected error for review rule priority 5")
+		}
+	})
+	t.Run("waiting without sync cache", func(t *testing.T) {
+		cfg := config{Token: "abc123", NextItems: defaultNextItemsConfig(), ReviewsConfig: defaultReviewsConfig(NextItemsConfig{})}
+		cfg.NextItems.Waiting.Mode = "label"
+		if err := cfg.Verify(); err == nil {
+			t.Error("expected error for waiting mode without sync_cache")
+		}
+		cfg.SyncCache = true
+		if err := cfg.Verify(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+	t.Run("stale without sync cache", func(t *testing.T) {
+		cfg := config{Token: "abc123", NextItems: defaultNextItemsConfig(), ReviewsConfig: defaultReviewsConfig(NextItemsConfig{})}
+		cfg.ReviewsConfig.NextItemsConfig.Stale.Mode = "label"
+		if err := cfg.Verify(); err == nil {
+			t.Error("expected error for stale mode without sync_cache")
+		}
+	})
 }
@@ -0,0 +1,123 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Fixture describes the account state a Server starts with.
+type Fixture struct {
+	Projects []Project `json:"projects" yaml:"projects"`
+	Sections []Section `json:"sections" yaml:"sections"`
+	Tasks    []Task    `json:"tasks" yaml:"tasks"`
+	Labels   []Label   `json:"labels" yaml:"labels"`
+	Comments []Comment `json:"comments" yaml:"comments"`
+}
+
+type Project struct {
+	ID          string `json:"id" yaml:"id"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	Color       string `json:"color" yaml:"color"`
+	ParentID    string `json:"parent_id" yaml:"parent_id"`
+	ChildOrder  int    `json:"child_order" yaml:"child_order"`
+}
+
+type Section struct {
+	ID           string `json:"id" yaml:"id"`
+	ProjectID    string `json:"project_id" yaml:"project_id"`
+	Name         string `json:"name" yaml:"name"`
+	SectionOrder int    `json:"section_order" yaml:"section_order"`
+}
+
+type Task struct {
+	ID          string   `json:"id" yaml:"id"`
+	Content     string   `json:"content" yaml:"content"`
+	Description string   `json:"description" yaml:"description"`
+	ProjectID   string   `json:"project_id" yaml:"project_id"`
+	SectionID   string   `json:"section_id" yaml:"section_id"`
+	ParentID    string   `json:"parent_id" yaml:"parent_id"`
+	ChildOrder  int      `json:"child_order" yaml:"child_order"`
+	Priority    int      `json:"priority" yaml:"priority"`
+	Labels      []string `json:"labels" yaml:"labels"`
+	// Deadline and Due are dates in YYYY-MM-DD form.
+	Deadline    string `json:"deadline" yaml:"deadline"`
+	Due         string `json:"due" yaml:"due"`
+	IsRecurring bool   `json:"is_recurring" yaml:"is_recurring"`
+	Checked     bool   `json:"checked" yaml:"checked"`
+	UpdatedAt   string `json:"updated_at" yaml:"updated_at"`
+}
+
+type Label struct {
+	ID    string `json:"id" yaml:"id"`
+	Name  string `json:"name" yaml:"name"`
+	Color string `json:"color" yaml:"color"`
+}
+
+type Comment struct {
+	ID      string `json:"id" yaml:"id"`
+	TaskID  string `json:"task_id" yaml:"task_id"`
+	Content string `json:"content" yaml:"content"`
+}
+
+// LoadFixture reads a fixture from a YAML or JSON file, chosen by extension.
+func LoadFixture(path string) (Fixture, error) {
+	var f Fixture
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &f)
+	case ".json":
+		err = json.Unmarshal(data, &f)
+	default:
+		return f, fmt.Errorf("unsupported fixture format: %s", path)
+	}
+	if err != nil {
+		return f, fmt.Errorf("parsing fixture %s: %w", path, err)
+	}
+	return f, f.validate()
+}
+
+func (f Fixture) validate() error {
+	projects := make(map[string]bool, len(f.Projects))
+	for _, p := range f.Projects {
+		if p.ID == "" {
+			return fmt.Errorf("project %q has no id", p.Name)
+		}
+		projects[p.ID] = true
+	}
+	sections := make(map[string]bool, len(f.Sections))
+	for _, sec := range f.Sections {
+		if !projects[sec.ProjectID] {
+			return fmt.Errorf("section %s references unknown project %q", sec.ID, sec.ProjectID)
+		}
+		sections[sec.ID] = true
+	}
+	tasks := make(map[string]bool, len(f.Tasks))
+	for _, t := range f.Tasks {
+		if t.ID == "" {
+			return fmt.Errorf("task %q has no id", t.Content)
+		}
+		if !projects[t.ProjectID] {
+			return fmt.Errorf("task %s references unknown project %q", t.ID, t.ProjectID)
+		}
+		if t.SectionID != "" && !sections[t.SectionID] {
+			return fmt.Errorf("task %s references unknown section %q", t.ID, t.SectionID)
+		}
+		tasks[t.ID] = true
+	}
+	for _, c := range f.Comments {
+		if !tasks[c.TaskID] {
+			return fmt.Errorf("comment %s references unknown task %q", c.ID, c.TaskID)
+		}
+	}
+	return nil
+}
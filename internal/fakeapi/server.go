@@ -0,0 +1,526 @@
+// Package fakeapi is an in-process fake of the Todoist API endpoints used by
+// godoist. It serves an account described by a Fixture, applies writes to it,
+// and records every write as a sync-style command so tests can assert on them.
+//
+// Point godoist at a running server by setting godoist.APIURL to its URL.
+package fakeapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Command is a write received by the server, normalized to the sync API's
+// command form regardless of whether it arrived via REST or /sync.
+type Command struct {
+	Type string                 `json:"type"`
+	UUID string                 `json:"uuid,omitempty"`
+	Args map[string]interface{} `json:"args"`
+}
+
+type entity struct {
+	data    map[string]interface{}
+	version int
+}
+
+func (e *entity) id() string { return e.data["id"].(string) }
+
+// Server is a fake Todoist API. It implements http.Handler.
+type Server struct {
+	// Token, if set, is required as the bearer token of every request.
+	Token string
+
+	mu       sync.Mutex
+	mux      *http.ServeMux
+	projects map[string]*entity
+	sections map[string]*entity
+	tasks    map[string]*entity
+	labels   map[string]*entity
+	comments map[string]*entity
+	commands []Command
+	version  int
+	nextID   int
+}
+
+// New returns a server serving the given fixture.
+func New(f Fixture) *Server {
+	s := &Server{
+		projects: make(map[string]*entity),
+		sections: make(map[string]*entity),
+		tasks:    make(map[string]*entity),
+		labels:   make(map[string]*entity),
+		comments: make(map[string]*entity),
+		version:  1,
+	}
+	for _, p := range f.Projects {
+		s.projects[p.ID] = &entity{data: projectData(p), version: s.version}
+	}
+	for _, sec := range f.Sections {
+		s.sections[sec.ID] = &entity{data: map[string]interface{}{
+			"id": sec.ID, "project_id": sec.ProjectID, "name": sec.Name, "section_order": sec.SectionOrder,
+			"is_archived": false, "is_deleted": false,
+		}, version: s.version}
+	}
+	for _, t := range f.Tasks {
+		s.tasks[t.ID] = &entity{data: taskData(t), version: s.version}
+	}
+	for _, l := range f.Labels {
+		s.labels[l.ID] = &entity{data: map[string]interface{}{"id": l.ID, "name": l.Name, "color": l.Color}, version: s.version}
+	}
+	for _, c := range f.Comments {
+		s.comments[c.ID] = &entity{data: map[string]interface{}{"id": c.ID, "task_id": c.TaskID, "content": c.Content}, version: s.version}
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("GET /tasks", s.list(func() map[string]*entity { return s.tasks }, isActive))
+	s.mux.HandleFunc("GET /tasks/{id}", s.get(func() map[string]*entity { return s.tasks }))
+	s.mux.HandleFunc("POST /tasks", s.write("item_add"))
+	s.mux.HandleFunc("POST /tasks/{id}", s.write("item_update"))
+	s.mux.HandleFunc("POST /tasks/{id}/close", s.write("item_close"))
+	s.mux.HandleFunc("POST /tasks/{id}/reopen", s.write("item_uncomplete"))
+	s.mux.HandleFunc("GET /projects", s.list(func() map[string]*entity { return s.projects }, isActive))
+	s.mux.HandleFunc("POST /projects", s.write("project_add"))
+	s.mux.HandleFunc("POST /projects/{id}", s.write("project_update"))
+	s.mux.HandleFunc("GET /sections", s.list(func() map[string]*entity { return s.sections }, isActive))
+	s.mux.HandleFunc("GET /comments", s.list(func() map[string]*entity { return s.comments }, isActive))
+	s.mux.HandleFunc("POST /comments", s.write("note_add"))
+	s.mux.HandleFunc("POST /comments/{id}", s.write("note_update"))
+	s.mux.HandleFunc("DELETE /comments/{id}", s.write("note_delete"))
+	s.mux.HandleFunc("POST /sync", s.sync)
+	return s
+}
+
+// Start serves the fake on a local listener. Close the returned server when done.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Commands returns all write commands received so far, in order.
+func (s *Server) Commands() []Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Command, len(s.commands))
+	copy(out, s.commands)
+	return out
+}
+
+// Task returns the current API representation of a task, or nil.
+func (s *Server) Task(id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.tasks[id]; ok {
+		return copyData(e.data)
+	}
+	return nil
+}
+
+// Project returns the current API representation of a project, or nil.
+func (s *Server) Project(id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.projects[id]; ok {
+		return copyData(e.data)
+	}
+	return nil
+}
+
+// TaskComments returns the content of the task's comments ordered by ID.
+func (s *Server) TaskComments(taskID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, e := range sorted(s.comments) {
+		if e.data["task_id"] == taskID && isActive(e) {
+			out = append(out, e.data["content"].(string))
+		}
+	}
+	return out
+}
+
+func isActive(e *entity) bool {
+	return e.data["checked"] != true && e.data["is_deleted"] != true && e.data["is_archived"] != true
+}
+
+// list serves a paginated list endpoint. Query parameters other than limit
+// and cursor are treated as equality filters, e.g. /comments?task_id=1.
+func (s *Server) list(source func() map[string]*entity, keep func(*entity) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		var results []map[string]interface{}
+		for _, e := range sorted(source()) {
+			if keep != nil && !keep(e) {
+				continue
+			}
+			if !matchesQuery(e, r.URL.Query()) {
+				continue
+			}
+			results = append(results, copyData(e.data))
+		}
+		s.mu.Unlock()
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = len(results)
+		}
+		if offset > len(results) {
+			offset = len(results)
+		}
+		end := min(offset+limit, len(results))
+		var next interface{}
+		if end < len(results) {
+			next = strconv.Itoa(end)
+		}
+		page := results[offset:end]
+		if page == nil {
+			page = []map[string]interface{}{}
+		}
+		writeJSON(w, map[string]interface{}{"results": page, "next_cursor": next})
+	}
+}
+
+func matchesQuery(e *entity, query map[string][]string) bool {
+	for key, values := range query {
+		if key == "limit" || key == "cursor" {
+			continue
+		}
+		if fmt.Sprint(e.data[key]) != values[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// get serves a single entity by ID. Like the REST API, it also returns
+// completed ones.
+func (s *Server) get(source func() map[string]*entity) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		e, ok := source()[r.PathValue("id")]
+		var data map[string]interface{}
+		if ok && e.data["is_deleted"] != true {
+			data = copyData(e.data)
+		}
+		s.mu.Unlock()
+		if data == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, data)
+	}
+}
+
+// write serves a REST write endpoint by translating it into a command.
+func (s *Server) write(cmdType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		args := map[string]interface{}{}
+		if r.ContentLength != 0 && r.Body != nil {
+			if err := json.NewDecoder(r.Body).Decode(&args); err != nil && !errors.Is(err, io.EOF) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if id := r.PathValue("id"); id != "" {
+			args["id"] = id
+		}
+		s.mu.Lock()
+		result, err := s.apply(Command{Type: cmdType, Args: args})
+		s.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if result == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, result)
+	}
+}
+
+type syncRequest struct {
+	SyncToken     string    `json:"sync_token"`
+	ResourceTypes []string  `json:"resource_types"`
+	Commands      []Command `json:"commands"`
+}
+
+// sync serves /sync: it executes any commands, then returns resources changed
+// since sync_token ("*" for everything).
+func (s *Server) sync(w http.ResponseWriter, r *http.Request) {
+	var req syncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := map[string]interface{}{}
+	if len(req.Commands) > 0 {
+		status := map[string]interface{}{}
+		for i, cmd := range req.Commands {
+			key := cmd.UUID
+			if key == "" {
+				key = strconv.Itoa(i)
+			}
+			if _, err := s.apply(cmd); err != nil {
+				status[key] = map[string]interface{}{"error": err.Error()}
+			} else {
+				status[key] = "ok"
+			}
+		}
+		resp["sync_status"] = status
+	}
+
+	full := req.SyncToken == "" || req.SyncToken == "*"
+	since, err := strconv.Atoi(req.SyncToken)
+	if !full && err != nil {
+		http.Error(w, "invalid sync token", http.StatusBadRequest)
+		return
+	}
+	resources := map[string]map[string]*entity{"items": s.tasks, "projects": s.projects, "sections": s.sections, "labels": s.labels, "notes": s.comments}
+	for _, rt := range req.ResourceTypes {
+		source, ok := resources[rt]
+		if !ok {
+			continue
+		}
+		out := []map[string]interface{}{}
+		for _, e := range sorted(source) {
+			if full && !isActive(e) {
+				continue
+			}
+			if !full && e.version <= since {
+				continue
+			}
+			out = append(out, copyData(e.data))
+		}
+		resp[rt] = out
+	}
+	resp["sync_token"] = strconv.Itoa(s.version)
+	resp["full_sync"] = full
+	writeJSON(w, resp)
+}
+
+// apply executes a command against the account state and records it.
+// The caller must hold s.mu.
+func (s *Server) apply(cmd Command) (map[string]interface{}, error) {
+	args := cmd.Args
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	id, _ := args["id"].(string)
+	var result map[string]interface{}
+
+	switch cmd.Type {
+	case "item_add":
+		id = s.newID()
+		data := taskData(Task{ID: id, Priority: 1})
+		mergeArgs(data, args)
+		data["id"] = id
+		s.tasks[id] = &entity{data: data}
+		s.touch(s.tasks[id])
+		result = copyData(data)
+	case "item_update":
+		e, ok := s.tasks[id]
+		if !ok {
+			return nil, fmt.Errorf("task not found: %s", id)
+		}
+		mergeArgs(e.data, args)
+		s.touch(e)
+		result = copyData(e.data)
+	case "item_close", "item_complete", "item_uncomplete":
+		e, ok := s.tasks[id]
+		if !ok {
+			return nil, fmt.Errorf("task not found: %s", id)
+		}
+		checked := cmd.Type != "item_uncomplete"
+		e.data["checked"] = checked
+		s.touch(e)
+		if checked {
+			for _, child := range s.tasks {
+				if child.data["parent_id"] == id && isActive(child) {
+					child.data["checked"] = true
+					s.touch(child)
+				}
+			}
+		}
+	case "item_delete":
+		e, ok := s.tasks[id]
+		if !ok {
+			return nil, fmt.Errorf("task not found: %s", id)
+		}
+		e.data["is_deleted"] = true
+		s.touch(e)
+	case "project_add":
+		id = s.newID()
+		data := projectData(Project{ID: id})
+		mergeArgs(data, args)
+		data["id"] = id
+		s.projects[id] = &entity{data: data}
+		s.touch(s.projects[id])
+		result = copyData(data)
+	case "project_update":
+		e, ok := s.projects[id]
+		if !ok {
+			return nil, fmt.Errorf("project not found: %s", id)
+		}
+		mergeArgs(e.data, args)
+		s.touch(e)
+		result = copyData(e.data)
+	case "note_add":
+		taskID, _ := args["task_id"].(string)
+		if _, ok := s.tasks[taskID]; !ok {
+			return nil, fmt.Errorf("task not found: %s", taskID)
+		}
+		id = s.newID()
+		data := map[string]interface{}{"id": id, "task_id": taskID, "content": args["content"], "posted_at": time.Now().UTC().Format(time.RFC3339)}
+		s.comments[id] = &entity{data: data}
+		s.touch(s.comments[id])
+		result = copyData(data)
+	case "note_update":
+		e, ok := s.comments[id]
+		if !ok || !isActive(e) {
+			return nil, fmt.Errorf("comment not found: %s", id)
+		}
+		mergeArgs(e.data, args)
+		s.touch(e)
+		result = copyData(e.data)
+	case "note_delete":
+		e, ok := s.comments[id]
+		if !ok || !isActive(e) {
+			return nil, fmt.Errorf("comment not found: %s", id)
+		}
+		e.data["is_deleted"] = true
+		s.touch(e)
+	default:
+		return nil, fmt.Errorf("unsupported command: %s", cmd.Type)
+	}
+
+	recorded := copyData(args)
+	recorded["id"] = id
+	s.commands = append(s.commands, Command{Type: cmd.Type, UUID: cmd.UUID, Args: recorded})
+	return result, nil
+}
+
+func (s *Server) newID() string {
+	s.nextID++
+	return "fake-" + strconv.Itoa(s.nextID)
+}
+
+// touch marks an entity as modified in a new sync version.
+func (s *Server) touch(e *entity) {
+	s.version++
+	e.version = s.version
+	if _, ok := e.data["updated_at"]; ok {
+		e.data["updated_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+}
+
+func mergeArgs(data, args map[string]interface{}) {
+	for k, v := range args {
+		if k == "id" {
+			continue
+		}
+		data[k] = v
+	}
+}
+
+func projectData(p Project) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          p.ID,
+		"name":        p.Name,
+		"description": p.Description,
+		"color":       defaultString(p.Color, "charcoal"),
+		"parent_id":   nullable(p.ParentID),
+		"child_order": p.ChildOrder,
+		"is_archived": false,
+		"is_deleted":  false,
+	}
+}
+
+func taskData(t Task) map[string]interface{} {
+	priority := t.Priority
+	if priority == 0 {
+		priority = 1
+	}
+	labels := t.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	data := map[string]interface{}{
+		"id":          t.ID,
+		"content":     t.Content,
+		"description": t.Description,
+		"project_id":  t.ProjectID,
+		"section_id":  nullable(t.SectionID),
+		"parent_id":   nullable(t.ParentID),
+		"child_order": t.ChildOrder,
+		"priority":    priority,
+		"labels":      labels,
+		"checked":     t.Checked,
+		"is_deleted":  false,
+		"updated_at":  defaultString(t.UpdatedAt, "2026-01-01T00:00:00Z"),
+		"deadline":    nil,
+		"due":         nil,
+	}
+	if t.Deadline != "" {
+		data["deadline"] = map[string]interface{}{"date": t.Deadline, "lang": "en"}
+	}
+	if t.Due != "" {
+		data["due"] = map[string]interface{}{"date": t.Due, "string": t.Due, "lang": "en", "is_recurring": t.IsRecurring, "timezone": nil}
+	}
+	return data
+}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// copyData returns a deep enough copy of an entity for callers to hold on to.
+func copyData(data map[string]interface{}) map[string]interface{} {
+	raw, _ := json.Marshal(data)
+	var out map[string]interface{}
+	json.Unmarshal(raw, &out)
+	return out
+}
+
+// sorted returns entities ordered by ID so responses are deterministic.
+func sorted(m map[string]*entity) []*entity {
+	out := make([]*entity, 0, len(m))
+	for _, e := range m {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].id() < out[j].id() })
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,172 @@
+package fakeapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testFixture() Fixture {
+	return Fixture{
+		Projects: []Project{{ID: "p1", Name: "Inbox"}},
+		Tasks: []Task{
+			{ID: "1", Content: "first", ProjectID: "p1", Labels: []string{"next"}},
+			{ID: "2", Content: "second", ProjectID: "p1", Deadline: "2026-01-02"},
+			{ID: "3", Content: "done", ProjectID: "p1", Checked: true},
+		},
+		Comments: []Comment{{ID: "c1", TaskID: "1", Content: "hello"}},
+	}
+}
+
+func do(t *testing.T, method, url string, body interface{}, out interface{}) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, url, &buf)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestListPagination(t *testing.T) {
+	srv := New(testFixture()).Start()
+	defer srv.Close()
+
+	var page struct {
+		Results    []map[string]interface{} `json:"results"`
+		NextCursor *string                  `json:"next_cursor"`
+	}
+	do(t, "GET", srv.URL+"/tasks?limit=1", nil, &page)
+	if len(page.Results) != 1 || page.NextCursor == nil {
+		t.Fatalf("first page = %v, cursor %v", page.Results, page.NextCursor)
+	}
+	do(t, "GET", srv.URL+"/tasks?limit=1&cursor="+*page.NextCursor, nil, &page)
+	if len(page.Results) != 1 || page.NextCursor != nil {
+		t.Fatalf("second page = %v, cursor %v", page.Results, page.NextCursor)
+	}
+	if page.Results[0]["deadline"].(map[string]interface{})["date"] != "2026-01-02" {
+		t.Errorf("deadline = %v", page.Results[0]["deadline"])
+	}
+
+	do(t, "GET", srv.URL+"/comments?task_id=1", nil, &page)
+	if len(page.Results) != 1 || page.Results[0]["content"] != "hello" {
+		t.Errorf("comments = %v", page.Results)
+	}
+}
+
+func TestWritesAreRecorded(t *testing.T) {
+	fake := New(testFixture())
+	srv := fake.Start()
+	defer srv.Close()
+
+	do(t, "POST", srv.URL+"/tasks/1", map[string]interface{}{"labels": []string{"home"}}, nil)
+	do(t, "POST", srv.URL+"/tasks/2/close", nil, nil)
+	var created map[string]interface{}
+	do(t, "POST", srv.URL+"/comments", map[string]interface{}{"task_id": "1", "content": "[CONTEXT] {}"}, &created)
+	if status := do(t, "POST", srv.URL+"/tasks/missing", map[string]interface{}{"priority": 4}, nil); status != http.StatusNotFound {
+		t.Errorf("update of missing task status = %d, want 404", status)
+	}
+
+	cmds := fake.Commands()
+	wantTypes := []string{"item_update", "item_close", "note_add"}
+	if len(cmds) != len(wantTypes) {
+		t.Fatalf("commands = %v", cmds)
+	}
+	for i, want := range wantTypes {
+		if cmds[i].Type != want {
+			t.Errorf("command %d type = %q, want %q", i, cmds[i].Type, want)
+		}
+	}
+	if cmds[0].Args["id"] != "1" {
+		t.Errorf("item_update args = %v", cmds[0].Args)
+	}
+	if labels := fake.Task("1")["labels"].([]interface{}); len(labels) != 1 || labels[0] != "home" {
+		t.Errorf("labels = %v, want [home]", labels)
+	}
+	if fake.Task("2")["checked"] != true {
+		t.Error("task 2 should be checked")
+	}
+	if got := fake.TaskComments("1"); len(got) != 2 || created["id"] == "" {
+		t.Errorf("comments = %v, created %v", got, created)
+	}
+}
+
+func TestSyncTokens(t *testing.T) {
+	fake := New(testFixture())
+	srv := fake.Start()
+	defer srv.Close()
+
+	var full struct {
+		SyncToken string                   `json:"sync_token"`
+		FullSync  bool                     `json:"full_sync"`
+		Items     []map[string]interface{} `json:"items"`
+	}
+	do(t, "POST", srv.URL+"/sync", map[string]interface{}{"sync_token": "*", "resource_types": []string{"items"}}, &full)
+	if !full.FullSync || len(full.Items) != 2 {
+		t.Fatalf("full sync = %+v", full)
+	}
+
+	do(t, "POST", srv.URL+"/sync", map[string]interface{}{
+		"sync_token":     full.SyncToken,
+		"resource_types": []string{"items"},
+		"commands":       []Command{{Type: "item_update", UUID: "u1", Args: map[string]interface{}{"id": "2", "priority": 4}}},
+	}, nil)
+
+	var delta struct {
+		FullSync bool                     `json:"full_sync"`
+		Items    []map[string]interface{} `json:"items"`
+	}
+	do(t, "POST", srv.URL+"/sync", map[string]interface{}{"sync_token": full.SyncToken, "resource_types": []string{"items"}}, &delta)
+	if delta.FullSync || len(delta.Items) != 1 || delta.Items[0]["id"] != "2" {
+		t.Errorf("delta = %+v", delta)
+	}
+	if cmds := fake.Commands(); len(cmds) != 1 || cmds[0].UUID != "u1" {
+		t.Errorf("commands = %v", cmds)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	fake := New(testFixture())
+	fake.Token = "secret"
+	srv := fake.Start()
+	defer srv.Close()
+	if status := do(t, "GET", srv.URL+"/tasks", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", status)
+	}
+}
+
+func TestLoadFixture(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "account.yaml")
+	os.WriteFile(yamlPath, []byte(`
+projects:
+  - {id: p1, name: Work}
+tasks:
+  - {id: t1, content: Write report, project_id: p1, labels: [next], priority: 3}
+`), 0o644)
+	f, err := LoadFixture(yamlPath)
+	if err != nil {
+		t.Fatalf("LoadFixture: %v", err)
+	}
+	if len(f.Tasks) != 1 || f.Tasks[0].Priority != 3 || f.Tasks[0].Labels[0] != "next" {
+		t.Errorf("fixture = %+v", f)
+	}
+
+	badPath := filepath.Join(dir, "bad.json")
+	os.WriteFile(badPath, []byte(`{"tasks": [{"id": "t1", "project_id": "nope"}]}`), 0o644)
+	if _, err := LoadFixture(badPath); err == nil {
+		t.Error("expected error for task with unknown project")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+// journalEntry is a single applied change, tagged with the run that made it.
+type journalEntry struct {
+	RunID string    `json:"run_id"`
+	Time  time.Time `json:"time"`
+	change
+}
+
+// journal is an append-only JSON lines log of every mutation automadoist applies.
+type journal struct {
+	path  string
+	runID string
+	mu    sync.Mutex
+}
+
+func newJournal(path string) *journal {
+	return &journal{path: path, runID: newRunID()}
+}
+
+func newRunID() string {
+	return time.Now().UTC().Format("20060102T150405.000Z")
+}
+
+func (j *journal) append(c change) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := json.Marshal(journalEntry{RunID: j.runID, Time: time.Now().UTC(), change: c})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// readJournal loads all entries from the journal file. A missing file yields no entries.
+func readJournal(path string) ([]journalEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// undoReasonPrefix starts the reason of every change made by undo.
+const undoReasonPrefix = "undo "
+
+// isUndoRun reports whether all entries of a run were made by undo.
+func isUndoRun(entries []journalEntry, runID string) bool {
+	for _, e := range entries {
+		if e.RunID == runID && !strings.HasPrefix(e.Reason, undoReasonPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// runEntries returns the entries of the given run. An empty runID selects the
+// most recent run that was not itself an undo, so repeated undos step back
+// through the history instead of undoing each other.
+func runEntries(entries []journalEntry, runID string) (string, []journalEntry) {
+	if runID == "" {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !isUndoRun(entries, entries[i].RunID) {
+				runID = entries[i].RunID
+				break
+			}
+		}
+		if runID == "" {
+			return "", nil
+		}
+	}
+	var out []journalEntry
+	for _, e := range entries {
+		if e.RunID == runID {
+			out = append(out, e)
+		}
+	}
+	return runID, out
+}
+
+// printRuns writes one line per recorded run, oldest first.
+func printRuns(w io.Writer, entries []journalEntry) {
+	var order []string
+	counts := make(map[string]int)
+	started := make(map[string]time.Time)
+	for _, e := range entries {
+		if _, ok := counts[e.RunID]; !ok {
+			order = append(order, e.RunID)
+			started[e.RunID] = e.Time
+		}
+		counts[e.RunID]++
+	}
+	for _, id := range order {
+		fmt.Fprintf(w, "%s  %s  %d change(s)\n", id, started[id].Local().Format(time.DateTime), counts[id])
+	}
+}
+
+// undoRun reverts the entries of a run in reverse order. Entries whose current value no
+// longer matches what the run set are skipped unless force is true, so later manual
+// edits are not clobbered. It returns descriptions of skipped entries.
+func undoRun(store taskStore, runID string, entries []journalEntry, cs *changeSet, force bool) ([]string, error) {
+	var skipped []string
+	reason := undoReasonPrefix + runID
+	for i := len(entries) - 1; i >= 0; i-- {
+		c := entries[i].change
+		if c.ProjectID != "" {
+			p := store.Project(c.ProjectID)
+			if p == nil {
+				skipped = append(skipped, fmt.Sprintf("%s (%s): project no longer exists", c.Content, c.ProjectID))
+				continue
+			}
+			if !force && p.Description != stringValue(c.New) {
+				skipped = append(skipped, fmt.Sprintf("%s (%s): description changed since run", c.Content, c.ProjectID))
+				continue
+			}
+			if err := applyProjectChange(cs, p, change{Field: c.Field, Old: c.New, New: c.Old, Reason: reason}); err != nil {
+				return skipped, fmt.Errorf("restoring %s of %q: %w", c.Field, p.Name, err)
+			}
+			continue
+		}
+
+		t := store.Task(c.TaskID)
+		if c.Field == "closed" && boolValue(c.New) {
+			// Completed tasks are not synced; one still in the store was
+			// reopened by hand.
+			if t != nil {
+				skipped = append(skipped, fmt.Sprintf("%s (%s): reopened since run", c.Content, c.TaskID))
+				continue
+			}
+			if err := cs.reopenTask(c.TaskID, c.Content, reason); err != nil {
+				return skipped, fmt.Errorf("reopening %q: %w", c.Content, err)
+			}
+			continue
+		}
+		if t == nil {
+			skipped = append(skipped, fmt.Sprintf("%s (%s): task no longer exists", c.Content, c.TaskID))
+			continue
+		}
+		if c.Field == "created" || c.Field == "closed" {
+			if !force && t.Content != c.Content {
+				skipped = append(skipped, fmt.Sprintf("%s (%s): content changed since run", c.Content, c.TaskID))
+				continue
+			}
+			if err := cs.closeTask(t, reason); err != nil {
+				return skipped, fmt.Errorf("closing %q: %w", t.Content, err)
+			}
+			continue
+		}
+		if !force && !currentMatches(t, c) {
+			skipped = append(skipped, fmt.Sprintf("%s (%s): %s changed since run", c.Content, c.TaskID, c.Field))
+			continue
+		}
+		if err := applyChange(cs, t, change{Field: c.Field, Old: c.New, New: c.Old, Reason: reason}); err != nil {
+			return skipped, fmt.Errorf("restoring %s of %q: %w", c.Field, t.Content, err)
+		}
+	}
+	return skipped, nil
+}
+
+// currentMatches reports whether the task still holds the value the change set.
+// Context comments are not synced, so they are always considered unchanged.
+func currentMatches(t *godoist.Task, c change) bool {
+	switch c.Field {
+	case "labels":
+		return sameLabels(t.Labels, labelsValue(c.New))
+	case "priority":
+		return t.Priority == priorityValue(c.New)
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestJournalRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "journal.jsonl")
+
+	first := &journal{path: path, runID: "run-1"}
+	first.append(change{TaskID: "1", Content: "a", Field: "labels", Old: []string{"home"}, New: []string{}})
+	first.append(change{TaskID: "1", Content: "a", Field: "priority", Old: godoist.HIGH, New: godoist.VERY_LOW})
+	second := &journal{path: path, runID: "run-2"}
+	second.append(change{ProjectID: "p1", Content: "Work", Field: "description", Old: "", New: "[automadoist:tags=work]"})
+
+	entries, err := readJournal(path)
+	if err != nil {
+		t.Fatalf("readJournal: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+
+	runID, latest := runEntries(entries, "")
+	if runID != "run-2" || len(latest) != 1 {
+		t.Errorf("latest run = %q with %d entries, want run-2 with 1", runID, len(latest))
+	}
+	_, byID := runEntries(entries, "run-1")
+	if len(byID) != 2 || byID[1].Field != "priority" {
+		t.Errorf("run-1 entries = %v", byID)
+	}
+
+	var buf bytes.Buffer
+	printRuns(&buf, entries)
+	if !strings.Contains(buf.String(), "run-1") || !strings.Contains(buf.String(), "2 change(s)") {
+		t.Errorf("printRuns output = %q", buf.String())
+	}
+}
+
+func TestReadJournalMissing(t *testing.T) {
+	entries, err := readJournal(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil || entries != nil {
+		t.Errorf("readJournal() = %v, %v; want nil, nil", entries, err)
+	}
+}
+
+func TestUndoRun(t *testing.T) {
+	store := newMemoryStore(nil, []godoist.Task{
+		{ID: "1", Content: "stripped", Labels: []string{"waiting"}, Priority: godoist.VERY_LOW},
+		{ID: "2", Content: "edited since", Labels: []string{"manual"}, Priority: godoist.VERY_LOW},
+	})
+	entries := []journalEntry{
+		{RunID: "r", change: change{TaskID: "1", Field: "labels", Old: []interface{}{"next", "home", "waiting"}, New: []interface{}{"waiting"}}},
+		{RunID: "r", change: change{TaskID: "1", Field: "priority", Old: float64(4), New: float64(1)}},
+		{RunID: "r", change: change{TaskID: "2", Field: "labels", Old: []interface{}{"next"}, New: []interface{}{}}},
+		{RunID: "r", change: change{TaskID: "3", Field: "labels", Old: []interface{}{"next"}, New: []interface{}{}}},
+	}
+
+	t.Run("skips drifted and missing", func(t *testing.T) {
+		cs := newChangeSet(store, false)
+		skipped, err := undoRun(store, "r", entries, cs, false)
+		if err != nil {
+			t.Fatalf("undoRun: %v", err)
+		}
+		task := store.Task("1")
+		if !sameLabels(task.Labels, []string{"next", "home", "waiting"}) {
+			t.Errorf("Labels = %v, want restored", task.Labels)
+		}
+		if task.Priority != godoist.HIGH {
+			t.Errorf("Priority = %v, want High", task.Priority)
+		}
+		if len(skipped) != 2 {
+			t.Errorf("skipped = %v, want 2 entries", skipped)
+		}
+		if got := store.Task("2").Labels; !sameLabels(got, []string{"manual"}) {
+			t.Errorf("drifted task labels = %v, want untouched", got)
+		}
+	})
+
+	t.Run("force restores drifted", func(t *testing.T) {
+		cs := newChangeSet(store, false)
+		if _, err := undoRun(store, "r", entries[2:3], cs, true); err != nil {
+			t.Fatalf("undoRun: %v", err)
+		}
+		if got := store.Task("2").Labels; !sameLabels(got, []string{"next"}) {
+			t.Errorf("Labels = %v, want [next]", got)
+		}
+	})
+}
+
+func TestCreatedTaskPlanAndUndo(t *testing.T) {
+	store := newMemoryStore([]godoist.Project{{ID: "p", Name: "Empty"}}, nil)
+
+	dry := newChangeSet(store, true)
+	if _, err := dry.createTask(godoist.Task{Content: "Define next action", ProjectID: "p"}, "stalled"); err != nil {
+		t.Fatalf("createTask: %v", err)
+	}
+	if len(store.Tasks()) != 0 {
+		t.Fatal("dry run created a task")
+	}
+	planned := dry.Changes()
+	if got := planned[0].target(); got != "new task in p" {
+		t.Errorf("target() = %q", got)
+	}
+
+	cs := newChangeSet(store, false)
+	if err := applyPlan(store, &plan{Changes: planned}, cs); err != nil {
+		t.Fatalf("applyPlan: %v", err)
+	}
+	tasks := store.Tasks()
+	if len(tasks) != 1 || tasks[0].Content != "Define next action" || tasks[0].ProjectID != "p" {
+		t.Fatalf("tasks after apply = %v", tasks)
+	}
+
+	var entries []journalEntry
+	for _, c := range cs.Changes() {
+		entries = append(entries, journalEntry{RunID: "r", change: c})
+	}
+	undo := newChangeSet(store, false)
+	skipped, err := undoRun(store, "r", entries, undo, false)
+	if err != nil || len(skipped) != 0 {
+		t.Fatalf("undoRun = %v, %v", skipped, err)
+	}
+	if len(store.Tasks()) != 0 {
+		t.Errorf("tasks after undo = %v, want the created task closed", store.Tasks())
+	}
+
+	// The undo is itself undone by reopening the task, and is skipped when
+	// picking the default run.
+	for _, c := range undo.Changes() {
+		entries = append(entries, journalEntry{RunID: "u", change: c})
+	}
+	if runID, _ := runEntries(entries, ""); runID != "r" {
+		t.Errorf("default run = %q, want r", runID)
+	}
+	_, undone := runEntries(entries, "u")
+	if skipped, err := undoRun(store, "u", undone, newChangeSet(store, false), false); err != nil || len(skipped) != 0 {
+		t.Fatalf("undoRun(u) = %v, %v", skipped, err)
+	}
+	if got := store.Tasks(); len(got) != 1 || got[0].Content != "Define next action" {
+		t.Errorf("tasks after undoing the undo = %v, want the task reopened", got)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// metadataPrefix opens a marker such as "[automadoist:tags=home,errand]".
+// Several keys may share a marker, separated by ";". Values may be quoted
+// ("a, b]") and backslash escapes any character.
+const metadataPrefix = "[automadoist:"
+
+var metadataKeyRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// metadataKeys validates the values of known keys. A nil validator accepts
+// any value.
+var metadataKeys = map[string]func(value string) error{
+	"tags":                   nil,
+	"priority":               validatePriorityValue,
+	"status":                 nil,
+	"sequential":             validateSequentialValue,
+	"sequential_subprojects": validateSequentialValue,
+	"defer":                  validateDeferValue,
+	"blocked_by":             validateBlockedByValue,
+	"review":                 validateReviewValue,
+	"last_reviewed":          validateTimestampValue,
+	"review_task":            validateTaskIDValue,
+}
+
+func validateSequentialValue(value string) error {
+	_, err := parseSequentialOrder(value)
+	return err
+}
+
+func validatePriorityValue(value string) error {
+	if p, err := strconv.Atoi(value); err != nil || p < 1 || p > 4 {
+		return fmt.Errorf("priority must be between 1 and 4: %q", value)
+	}
+	return nil
+}
+
+type metadataEntry struct {
+	key      string
+	raw      string // value as written, still quoted and escaped
+	hasValue bool
+}
+
+type metadataMarker struct {
+	start, end int // byte offsets in the original text
+	entries    []metadataEntry
+	dirty      bool
+}
+
+// metadata is the set of markers found in a description or name. Editing it
+// only rewrites the markers that changed, so the surrounding text round-trips.
+type metadata struct {
+	text    string
+	markers []*metadataMarker
+	errs    []error
+}
+
+// parseMetadata finds all markers in text. Malformed markers are left as
+// plain text and reported by validate.
+func parseMetadata(text string) *metadata {
+	m := &metadata{text: text}
+	for pos := 0; ; {
+		i := strings.Index(text[pos:], metadataPrefix)
+		if i < 0 {
+			break
+		}
+		start := pos + i
+		body, end, ok := scanMarker(text, start+len(metadataPrefix))
+		if !ok {
+			m.errs = append(m.errs, fmt.Errorf("unterminated marker at offset %d", start))
+			break
+		}
+		marker := &metadataMarker{start: start, end: end}
+		for _, part := range splitUnquoted(body, ';') {
+			key, raw, hasValue := cutUnquoted(part, '=')
+			key = strings.TrimSpace(key)
+			if key == "" && !hasValue {
+				continue
+			}
+			if !metadataKeyRegex.MatchString(key) {
+				m.errs = append(m.errs, fmt.Errorf("invalid key %q", key))
+				continue
+			}
+			marker.entries = append(marker.entries, metadataEntry{key: key, raw: strings.TrimSpace(raw), hasValue: hasValue})
+		}
+		m.markers = append(m.markers, marker)
+		pos = end
+	}
+	return m
+}
+
+// scanMarker returns the marker body starting at from and the offset just
+// past its closing bracket.
+func scanMarker(text string, from int) (string, int, bool) {
+	quoted := false
+	for i := from; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == ']' && !quoted:
+			return text[from:i], i + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// splitUnquoted splits s on sep outside quotes and escapes.
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	quoted, last := false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+func cutUnquoted(s string, sep byte) (string, string, bool) {
+	parts := splitUnquoted(s, sep)
+	if len(parts) == 1 {
+		return s, "", false
+	}
+	return parts[0], s[len(parts[0])+1:], true
+}
+
+// unquote resolves quotes and escapes in a raw value.
+func unquote(raw string) string {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '\\' && i+1 < len(raw):
+			i++
+			b.WriteByte(raw[i])
+		case c == '"':
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// quote encodes a value so it reads back unchanged, quoting it when it
+// contains a separator or bracket.
+func quote(value string) string {
+	if value == "" || !strings.ContainsAny(value, `,;=[]"\`) && strings.TrimSpace(value) == value {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func (m *metadata) lookup(key string) (*metadataEntry, bool) {
+	for _, marker := range m.markers {
+		for i := range marker.entries {
+			if marker.entries[i].key == key {
+				return &marker.entries[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// has reports whether key is present, with or without a value.
+func (m *metadata) has(key string) bool {
+	_, ok := m.lookup(key)
+	return ok
+}
+
+// get returns the value of key with quotes and escapes resolved.
+func (m *metadata) get(key string) (string, bool) {
+	e, ok := m.lookup(key)
+	if !ok {
+		return "", false
+	}
+	return unquote(e.raw), true
+}
+
+// list returns the comma-separated items of key, skipping empty ones.
+func (m *metadata) list(key string) []string {
+	e, ok := m.lookup(key)
+	if !ok || !e.hasValue {
+		return nil
+	}
+	var items []string
+	for _, item := range splitUnquoted(e.raw, ',') {
+		if item = strings.TrimSpace(unquote(strings.TrimSpace(item))); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// set stores a single value for key, replacing it in place if present and
+// otherwise adding it to the last marker.
+func (m *metadata) set(key, value string) {
+	m.setRaw(key, quote(value))
+}
+
+// setList stores the items of key as a comma-separated list.
+func (m *metadata) setList(key string, items []string) {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = quote(item)
+	}
+	m.setRaw(key, strings.Join(quoted, ","))
+}
+
+func (m *metadata) setRaw(key, raw string) {
+	found := false
+	for _, marker := range m.markers {
+		kept := marker.entries[:0]
+		for _, e := range marker.entries {
+			if e.key != key {
+				kept = append(kept, e)
+				continue
+			}
+			marker.dirty = true
+			if !found {
+				found = true
+				kept = append(kept, metadataEntry{key: key, raw: raw, hasValue: true})
+			}
+		}
+		marker.entries = kept
+	}
+	if found {
+		return
+	}
+	// New keys join the last marker, or start one of their own.
+	for i := len(m.markers) - 1; i >= 0; i-- {
+		if len(m.markers[i].entries) > 0 {
+			m.markers[i].entries = append(m.markers[i].entries, metadataEntry{key: key, raw: raw, hasValue: true})
+			m.markers[i].dirty = true
+			return
+		}
+	}
+	m.markers = append(m.markers, &metadataMarker{
+		start: -1, dirty: true,
+		entries: []metadataEntry{{key: key, raw: raw, hasValue: true}},
+	})
+}
+
+// remove deletes key. A marker left without keys is dropped from the text.
+func (m *metadata) remove(key string) {
+	for _, marker := range m.markers {
+		kept := marker.entries[:0]
+		for _, e := range marker.entries {
+			if e.key == key {
+				marker.dirty = true
+				continue
+			}
+			kept = append(kept, e)
+		}
+		marker.entries = kept
+	}
+}
+
+// validate reports malformed markers, unknown keys and invalid values.
+func (m *metadata) validate() []error {
+	errs := append([]error{}, m.errs...)
+	for _, marker := range m.markers {
+		for _, e := range marker.entries {
+			check, known := metadataKeys[e.key]
+			if !known {
+				errs = append(errs, fmt.Errorf("unknown key %q", e.key))
+				continue
+			}
+			if check != nil {
+				if err := check(unquote(e.raw)); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", e.key, err))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// String renders the text with edited markers rewritten and a new marker
+// appended on its own line. Text is trimmed only when a marker was removed.
+func (m *metadata) String() string {
+	var b strings.Builder
+	pos, removed := 0, false
+	var added []string
+	for _, marker := range m.markers {
+		if marker.start < 0 {
+			added = append(added, marker.render())
+			continue
+		}
+		b.WriteString(m.text[pos:marker.start])
+		pos = marker.end
+		switch {
+		case !marker.dirty:
+			b.WriteString(m.text[marker.start:marker.end])
+		case len(marker.entries) > 0:
+			b.WriteString(marker.render())
+		default:
+			removed = true
+		}
+	}
+	b.WriteString(m.text[pos:])
+	out := b.String()
+	if removed {
+		out = strings.TrimSpace(out)
+	}
+	for _, marker := range added {
+		if out != "" {
+			out += "\n"
+		}
+		out += marker
+	}
+	return out
+}
+
+func (marker *metadataMarker) render() string {
+	parts := make([]string, len(marker.entries))
+	for i, e := range marker.entries {
+		parts[i] = e.key
+		if e.hasValue {
+			parts[i] += "=" + e.raw
+		}
+	}
+	return metadataPrefix + strings.Join(parts, ";") + "]"
+}
+
+// withoutMarkers returns the text with all markers removed.
+func (m *metadata) withoutMarkers() string {
+	var b strings.Builder
+	pos := 0
+	for _, marker := range m.markers {
+		if marker.start < 0 {
+			continue
+		}
+		b.WriteString(m.text[pos:marker.start])
+		pos = marker.end
+	}
+	b.WriteString(m.text[pos:])
+	return b.String()
+}
+
+// warnInvalidMetadata logs the invalid metadata of every project, section and
+// task once. The pipelines parse the same descriptions many times per run, so
+// validation happens here, after each sync, instead of on every parse.
+func warnInvalidMetadata(store taskStore) {
+	warn := func(kind, name, text string) {
+		for _, err := range parseMetadata(text).validate() {
+			logger.Warn("Invalid automadoist metadata", kind, name, "error", err)
+		}
+	}
+	for _, p := range store.Projects() {
+		warn("project", p.Name, p.Description)
+		for _, sec := range store.ProjectSections(p) {
+			warn("section", sec.Name, sec.Name)
+		}
+	}
+	for _, t := range store.Tasks() {
+		warn("task", t.Content, t.Description)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestParseMetadata(t *testing.T) {
+	text := "Client work\n[automadoist:tags=home, \"a,b\";sequential=2]\n[automadoist:status=\"waiting [on] \\\"them\\\"\"] trailing"
+	m := parseMetadata(text)
+
+	if got := m.list("tags"); !reflect.DeepEqual(got, []string{"home", "a,b"}) {
+		t.Errorf("list(tags) = %q", got)
+	}
+	if got, ok := m.get("sequential"); !ok || got != "2" {
+		t.Errorf("get(sequential) = %q, %v", got, ok)
+	}
+	if got, _ := m.get("status"); got != `waiting [on] "them"` {
+		t.Errorf("get(status) = %q", got)
+	}
+	if m.has("defer") {
+		t.Error("has(defer) = true, want false")
+	}
+	if got := m.String(); got != text {
+		t.Errorf("String() = %q, want unchanged %q", got, text)
+	}
+	if got := m.withoutMarkers(); got != "Client work\n\n trailing" {
+		t.Errorf("withoutMarkers() = %q", got)
+	}
+}
+
+func TestMetadataEdit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		edit func(m *metadata)
+		want string
+	}{
+		{
+			"set keeps surrounding text",
+			"Intro\n[automadoist:tags=a;sequential]\nOutro",
+			func(m *metadata) { m.set("sequential", "last") },
+			"Intro\n[automadoist:tags=a;sequential=last]\nOutro",
+		},
+		{
+			"set appends new marker",
+			"Intro",
+			func(m *metadata) { m.set("status", "on hold; maybe") },
+			"Intro\n[automadoist:status=\"on hold; maybe\"]",
+		},
+		{
+			"set adds to the last marker",
+			"[automadoist:tags=a] Intro [automadoist:review=7d]",
+			func(m *metadata) { m.set("review_task", "123") },
+			"[automadoist:tags=a] Intro [automadoist:review=7d;review_task=123]",
+		},
+		{
+			"remove one key of a marker",
+			"[automadoist:tags=a;sequential] Intro",
+			func(m *metadata) { m.remove("tags") },
+			"[automadoist:sequential] Intro",
+		},
+		{
+			"remove last key drops marker",
+			"Intro\n[automadoist:tags=a]",
+			func(m *metadata) { m.remove("tags") },
+			"Intro",
+		},
+		{
+			"duplicate keys collapse",
+			"[automadoist:tags=a] [automadoist:tags=b]",
+			func(m *metadata) { m.setList("tags", []string{"c", "d]"}) },
+			"[automadoist:tags=c,\"d]\"]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := parseMetadata(tt.text)
+			tt.edit(m)
+			got := m.String()
+			if got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			// The edited text parses back to the same values.
+			again := parseMetadata(got)
+			for _, marker := range m.markers {
+				for _, e := range marker.entries {
+					if v, _ := again.get(e.key); v != unquote(e.raw) {
+						t.Errorf("round trip %s = %q, want %q", e.key, v, unquote(e.raw))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMetadataValidate(t *testing.T) {
+	tests := []struct {
+		text string
+		errs int
+	}{
+		{"[automadoist:tags=a;sequential=first]", 0},
+		{"[automadoist:priority=4;status=someday]", 0},
+		{"[automadoist:priority=p1]", 1},
+		{"[automadoist:sequential=middle]", 1},
+		{"[automadoist:bogus=1]", 1},
+		{"[automadoist:Bad Key=1]", 1},
+		{"[automadoist:tags=\"unterminated]", 1},
+		{"no markers [automadoist is mentioned]", 0},
+	}
+	for _, tt := range tests {
+		if got := parseMetadata(tt.text).validate(); len(got) != tt.errs {
+			t.Errorf("validate(%q) = %v, want %d errors", tt.text, got, tt.errs)
+		}
+	}
+}
+
+func TestInvalidMetadataWarnedOncePerRun(t *testing.T) {
+	var buf bytes.Buffer
+	old := logger
+	logger = slog.New(slog.NewTextHandler(&buf, nil))
+	t.Cleanup(func() { logger = old })
+
+	store := newMemoryStore(
+		[]godoist.Project{{ID: "root", Name: "projects", Description: "[automadoist:sequential=middle]"}},
+		[]godoist.Task{
+			{ID: "t1", Content: "Book flights", ProjectID: "root", Description: "[automadoist:defer=someday]"},
+			{ID: "t2", Content: "Pack", ProjectID: "root"},
+		},
+	)
+	warnInvalidMetadata(store)
+	for i := 0; i < 2; i++ {
+		process_next_items(store, defaultNextItemsConfig(), newChangeSet(store, false))
+	}
+
+	if got := strings.Count(buf.String(), "Invalid automadoist metadata"); got != 2 {
+		t.Errorf("logged %d metadata warnings, want one each for the project and the task:\n%s", got, buf.String())
+	}
+}
@@ -10,15 +10,26 @@ import (
 
 type NextItemsConfig struct {
 	EntryPoint       string         `koanf:"entry_point"`
+	Roots            []RootConfig   `koanf:"roots"`
 	SkipPrefixes     []string       `koanf:"skip_prefixes"`
 	Recursive        bool           `koanf:"recursive"`
 	SequentialMarker string         `koanf:"sequential_marker"`
+	SequentialOrder  string         `koanf:"sequential_order"`
 	SkipDeadline     string         `koanf:"skip_deadline"`
+	DeferLabel       string         `koanf:"defer_label"`
 	ManagedLabels    []string       `koanf:"managed_labels"`
 	IgnoreLabels     []string       `koanf:"ignore_labels"`
 	Prune            bool           `koanf:"prune"`
+	Depth            int            `koanf:"depth"`
 	ColorPriority    map[string]int `koanf:"color_priority"`
 	ContextLabels    []string       `koanf:"context_labels"`
+	Stalled          StalledConfig  `koanf:"stalled"`
+	Waiting          WaitingConfig  `koanf:"waiting"`
+	Stale            StaleConfig    `koanf:"stale"`
+
+	// retainLabels are owned by other pipelines and kept, like IgnoreLabels,
+	// when a task stops being a next action.
+	retainLabels []string
 }
 
 func defaultNextItemsConfig() NextItemsConfig {
@@ -27,32 +38,91 @@ func defaultNextItemsConfig() NextItemsConfig {
 		SkipPrefixes:     []string{"*"},
 		Recursive:        true,
 		SequentialMarker: "!",
+		SequentialOrder:  "last",
 		SkipDeadline:     "not_overdue",
 		ManagedLabels:    []string{"next"},
 		IgnoreLabels:     []string{"waiting", "review"},
 		Prune:            true,
+		Stalled:          defaultStalledConfig(),
+		Waiting:          defaultWaitingConfig(),
+		Stale:            defaultStaleConfig(),
 	}
 }
 
-func process_next_items(client *godoist.Todoist, cfg NextItemsConfig) {
+func process_next_items(store taskStore, cfg NextItemsConfig, cs *changeSet) {
 	logger.Debug("Processing next items", "config", cfg)
-	logger.Debug("Entry point", "entry_point", cfg.EntryPoint)
-	entry_search := client.Projects.GetByName(cfg.EntryPoint)
-	if len(entry_search) != 1 {
-		logger.Error("Entry point not found")
+	scopes := resolveRoots(store, cfg)
+	for _, scope := range scopes {
+		logger.Debug("Entry point", "entry_point", scope.cfg.EntryPoint)
+		// Outside recursive mode the run is scoped to the evaluated projects, so a
+		// rollout can be staged on part of the tree.
+		processProjects(store, scope.cfg, cs, scope.projects, scope.candidates(store, scopes))
+	}
+}
+
+// projectDepth returns how many levels of subprojects below the entry point
+// are evaluated, or -1 for all of them.
+func (c NextItemsConfig) projectDepth() int {
+	if c.Recursive {
+		return -1
+	}
+	return c.Depth
+}
+
+// processNextItemsSubtree recomputes next actions for a single project and its
+// subprojects. Only tasks inside the subtree are considered for removal, so the
+// rest of the account is left untouched.
+func processNextItemsSubtree(store taskStore, cfg NextItemsConfig, cs *changeSet, projectID string) {
+	project := store.Project(projectID)
+	if project == nil {
+		logger.Warn("Project not found", "project", projectID)
 		return
 	}
-	entry := entry_search[0]
+	found := false
+	for _, scope := range resolveRoots(store, cfg) {
+		var projects []godoist.Project
+		for _, p := range scope.projects {
+			if isInSubtree(store, &p, project) {
+				projects = append(projects, p)
+			}
+		}
+		if len(projects) > 0 {
+			found = true
+			processProjects(store, scope.cfg, cs, projects, GetTasks(store, projects))
+		}
+	}
+	if !found {
+		logger.Debug("Project outside entry point, skipping", "project", project.Name)
+	}
+}
 
-	allSubProjects := collectProjects(*entry)
-	allTasks := client.Tasks.All()
+// isInSubtree reports whether project is root or one of its descendants.
+func isInSubtree(store taskStore, project, root *godoist.Project) bool {
+	for p := project; p != nil; p = store.Project(p.ParentID) {
+		if p.ID == root.ID {
+			return true
+		}
+		if p.ParentID == "" {
+			break
+		}
+	}
+	return false
+}
+
+// processProjects labels the next actions of the given projects and strips the
+// managed labels from candidates that are no longer next actions. Projects in a
+// later phase of a parent with sequential subprojects contribute no actions.
+func processProjects(store taskStore, cfg NextItemsConfig, cs *changeSet, allSubProjects []godoist.Project, candidates []*godoist.Task) {
 	nextTasks := []*godoist.Task{}
-	for _, project := range allSubProjects {
-		tasks := getNextTasks(project, cfg)
-		nextTasks = append(nextTasks, tasks...)
+	active := activeProjects(store, allSubProjects)
+	traversals := make(map[string]projectTraversal, len(active))
+	for _, project := range active {
+		traversal := traverseProject(store, project, cfg)
+		traversals[project.ID] = traversal
+		nextTasks = append(nextTasks, traversal.next...)
 	}
 	var hasManagedLabel []*godoist.Task
-	for _, task := range allTasks {
+	for _, task := range candidates {
 		if hasLabel(cfg.ManagedLabels, task) {
 			hasManagedLabel = append(hasManagedLabel, task)
 		}
@@ -64,6 +134,12 @@ func process_next_items(client *godoist.Todoist, cfg NextItemsConfig) {
 			needRemoval = append(needRemoval, task)
 		}
 	}
+	if !cfg.Prune {
+		for _, t := range needRemoval {
+			logger.Warn("Stale next action left in place, prune is disabled", "task", t.Content, "id", t.ID)
+		}
+		needRemoval = nil
+	}
 
 	var needAddition []*godoist.Task
 	for _, t := range nextTasks {
@@ -75,31 +151,73 @@ func process_next_items(client *godoist.Todoist, cfg NextItemsConfig) {
 	// Precompute project lookup maps for context operations
 	projectTags, projectColors := buildProjectMaps(allSubProjects)
 	contextEnabled := len(cfg.ContextLabels) > 0
+	// Reading a context comment costs an API call unless the sync cache holds
+	// it, so comments are only read where a decision depends on them: saved
+	// context and label provenance with context_labels, and the record of the
+	// stale check when it is enabled.
+	needContext := contextEnabled || cfg.Stale.Mode != ""
 
 	// Phase 1: Tasks LOSING @next
 	runParallel(needRemoval, func(t *godoist.Task) {
 		logger.Debug("Processing removal", "task", t.Content, "label", cfg.ManagedLabels[0])
 
+		ctx := map[string]interface{}{}
+		if needContext {
+			var err error
+			if ctx, err = cs.context(t); err != nil {
+				logger.Error("Failed to read context", "task", t.Content, "error", err)
+				ctx = map[string]interface{}{}
+			}
+		}
+
+		unflagStale(cfg, cs, t, ctx)
+
+		// Strip what automadoist put there: the managed and stale labels, the
+		// labels recorded when the task became a next action and the context
+		// labels, which are saved below if customized. Tasks labeled before
+		// provenance was recorded fall back to the project's default tags.
+		strip := append(append(append([]string{}, cfg.ManagedLabels...), cfg.ContextLabels...), cfg.Stale.labels()...)
+		if added, ok := addedLabels(ctx); ok {
+			strip = append(strip, added...)
+		} else {
+			strip = append(strip, projectTags[t.ProjectID]...)
+		}
+		keep := append(append([]string{}, cfg.IgnoreLabels...), cfg.retainLabels...)
+
+		// Only a priority automadoist set is reverted; one set by hand stays
+		// on the task and needs no saving.
+		defaultLabels, defaultPriority := computeExpectedDefaults(t, projectTags, projectColors, cfg.ColorPriority, cfg.ContextLabels)
+		owned := ownsPriority(ctx, t.Priority, defaultPriority)
+		if !owned {
+			defaultPriority = t.Priority
+		}
+
 		// Save context if task has customizations
-		if contextEnabled {
-			defaultLabels, defaultPriority := computeExpectedDefaults(t, projectTags, projectColors, cfg.ColorPriority, cfg.ContextLabels)
-			if hasCustomizations(t, defaultLabels, defaultPriority, cfg.ContextLabels) {
-				logger.Debug("Saving context for task", "task", t.Content)
-				if err := saveContext(t, cfg.ContextLabels); err != nil {
-					logger.Error("Failed to save context", "task", t.Content, "error", err)
-				}
+		updates := map[string]interface{}{addedLabelsKey: nil, setPriorityKey: nil, nextSinceKey: nil, staleAtKey: nil, stalePriorityKey: nil}
+		reason := "no longer a next action"
+		if contextEnabled && hasCustomizations(t, defaultLabels, defaultPriority, cfg.ContextLabels) {
+			logger.Debug("Saving context for task", "task", t.Content)
+			for k, v := range contextMap(computeSaveableLabels(t, cfg.ContextLabels), t.Priority) {
+				updates[k] = v
+			}
+			if !owned {
+				delete(updates, "priority")
+			}
+			reason = "saving customized context"
+		}
+		if needContext {
+			if err := cs.updateContext(t, updates, reason); err != nil {
+				logger.Error("Failed to save context", "task", t.Content, "error", err)
 			}
 		}
 
-		// Strip labels: keep only ignore labels
-		retained := computeRetainedLabels(t, cfg.IgnoreLabels)
-		if err := t.Update("labels", retained); err != nil {
+		if err := cs.setLabels(t, computeRetainedLabels(t, strip, keep), "no longer a next action"); err != nil {
 			logger.Error("Failed to update labels", "task", t.Content, "error", err)
 		}
 
 		// Reset priority
-		if t.Priority != godoist.VERY_LOW {
-			if err := t.Update("priority", godoist.VERY_LOW); err != nil {
+		if owned {
+			if err := cs.setPriority(t, godoist.VERY_LOW, "no longer a next action"); err != nil {
 				logger.Error("Failed to update priority", "task", t.Content, "error", err)
 			}
 		}
@@ -109,51 +227,51 @@ func process_next_items(client *godoist.Todoist, cfg NextItemsConfig) {
 	runParallel(needAddition, func(t *godoist.Task) {
 		logger.Debug("Processing addition", "task", t.Content, "label", cfg.ManagedLabels[0])
 
-		// Check for saved context
-		var saved *taskContext
-		if contextEnabled {
+		ctx := map[string]interface{}{}
+		if needContext {
 			var err error
-			saved, err = restoreContext(t)
-			if err != nil {
-				logger.Error("Failed to restore context", "task", t.Content, "error", err)
+			if ctx, err = cs.context(t); err != nil {
+				logger.Error("Failed to read context", "task", t.Content, "error", err)
+				ctx = map[string]interface{}{}
 			}
 		}
+		var saved *taskContext
+		if contextEnabled {
+			saved = savedContext(ctx)
+		}
 
+		before := toSet(t.Labels)
+		labelSet := toSet(t.Labels)
+		labelSet[cfg.ManagedLabels[0]] = true
+		updates := map[string]interface{}{}
+		reason := "next action"
 		if saved != nil {
 			// Restore from saved context
-			labelSet := toSet(t.Labels)
-			labelSet[cfg.ManagedLabels[0]] = true
 			for _, label := range saved.Labels {
 				labelSet[label] = true
 			}
-			var labels []string
-			for label := range labelSet {
-				labels = append(labels, label)
-			}
-			if err := t.Update("labels", labels); err != nil {
+			if err := cs.setLabels(t, sortedKeys(labelSet), "next action, restored saved context"); err != nil {
 				logger.Error("Failed to update labels", "task", t.Content, "error", err)
 			}
-			if err := t.Update("priority", saved.Priority); err != nil {
-				logger.Error("Failed to update priority", "task", t.Content, "error", err)
-			}
-			if err := t.DeleteContext(); err != nil {
-				logger.Error("Failed to delete context", "task", t.Content, "error", err)
+			// A priority set by hand while the task was inactive wins.
+			if saved.HasPriority && t.Priority == godoist.VERY_LOW {
+				if err := cs.setPriority(t, saved.Priority, "restored saved context"); err != nil {
+					logger.Error("Failed to update priority", "task", t.Content, "error", err)
+				} else {
+					updates[setPriorityKey] = int(saved.Priority)
+				}
 			}
+			updates["labels"], updates["priority"] = nil, nil
+			reason = "context restored"
 			logger.Debug("Restored context for task", "task", t.Content, "labels", saved.Labels, "priority", saved.Priority)
 		} else {
 			// Apply defaults for newly qualifying tasks
-			labelSet := toSet(t.Labels)
-			labelSet[cfg.ManagedLabels[0]] = true
 			if tags, ok := projectTags[t.ProjectID]; ok {
 				for _, tag := range tags {
 					labelSet[tag] = true
 				}
 			}
-			var labels []string
-			for label := range labelSet {
-				labels = append(labels, label)
-			}
-			if err := t.Update("labels", labels); err != nil {
+			if err := cs.setLabels(t, sortedKeys(labelSet), "next action, project default tags"); err != nil {
 				logger.Error("Failed to update labels", "task", t.Content, "error", err)
 			}
 
@@ -162,21 +280,60 @@ func process_next_items(client *godoist.Todoist, cfg NextItemsConfig) {
 				if color, ok := projectColors[t.ProjectID]; ok {
 					if priority, ok := cfg.ColorPriority[color]; ok {
 						logger.Debug("Setting priority from project color", "task", t.Content, "color", color, "priority", priority)
-						if err := t.Update("priority", godoist.PRIORITY_LEVEL(priority)); err != nil {
+						if err := cs.setPriority(t, godoist.PRIORITY_LEVEL(priority), "project color "+color); err != nil {
 							logger.Error("Failed to update priority", "task", t.Content, "error", err)
+						} else {
+							updates[setPriorityKey] = priority
 						}
 					}
 				}
 			}
 		}
+
+		if contextEnabled {
+			recordAddedLabels(updates, ctx, before, labelSet, cfg.ManagedLabels, projectTags[t.ProjectID])
+		}
+		if cfg.Stale.Mode != "" {
+			updates[nextSinceKey] = time.Now().Format(time.RFC3339)
+		}
+		if needContext {
+			if err := cs.updateContext(t, updates, reason); err != nil {
+				logger.Error("Failed to update context", "task", t.Content, "error", err)
+			}
+		}
 	})
+
+	flagStalled(store, cfg, cs, active, traversals, candidates)
+	// Candidates reach beyond the scope so stale labels can be stripped;
+	// follow-ups are only for the scope's own tasks.
+	inScope := make(map[string]bool, len(allSubProjects))
+	for _, p := range allSubProjects {
+		inScope[p.ID] = true
+	}
+	var scoped []*godoist.Task
+	for _, task := range candidates {
+		if inScope[task.ProjectID] {
+			scoped = append(scoped, task)
+		}
+	}
+	followUpWaiting(store, cfg, cs, scoped, time.Now())
+	flagStale(cfg, cs, nextTasks, time.Now())
 }
 
-func collectProjects(project godoist.Project) []godoist.Project {
+func collectProjects(store taskStore, project godoist.Project) []godoist.Project {
+	return collectProjectsDepth(store, project, -1)
+}
+
+// collectProjectsDepth returns project and its subprojects down to depth
+// levels below it. A negative depth collects all of them.
+func collectProjectsDepth(store taskStore, project godoist.Project, depth int) []godoist.Project {
 	var allProjects []godoist.Project
 	allProjects = append(allProjects, project)
-	for _, subproject := range project.GetChildren() {
-		allProjects = append(allProjects, collectProjects(*subproject)...)
+	if depth == 0 {
+		return allProjects
+	}
+	for _, subproject := range store.ChildProjects(&project) {
+		allProjects = append(allProjects, collectProjectsDepth(store, *subproject, depth-1)...)
 	}
 	return allProjects
 }
@@ -190,10 +347,10 @@ func isTaskInList(task *godoist.Task, taskList []*godoist.Task) bool {
 	return false
 }
 
-func GetTasks(projects []godoist.Project) []*godoist.Task {
+func GetTasks(store taskStore, projects []godoist.Project) []*godoist.Task {
 	var tasks []*godoist.Task
 	for _, project := range projects {
-		tasks = append(tasks, project.GetTasks()...)
+		tasks = append(tasks, store.ProjectTasks(&project)...)
 	}
 	return tasks
 }
@@ -217,60 +374,108 @@ func hasLabel(labels []string, task *godoist.Task) bool {
 	}
 	return false
 }
-func getNextTasks(project godoist.Project, cfg NextItemsConfig) []*godoist.Task {
-	tasks := project.GetTasks()
+func getNextTasks(store taskStore, project godoist.Project, cfg NextItemsConfig) []*godoist.Task {
+	return traverseProject(store, project, cfg).next
+}
+
+// projectTraversal is what traverseProject found in a project.
+type projectTraversal struct {
+	next []*godoist.Task
+	// parents are the parallel parent tasks that were expanded.
+	parents  []*godoist.Task
+	deferred bool
+}
+
+func traverseProject(store taskStore, project godoist.Project, cfg NextItemsConfig) projectTraversal {
+	tasks := store.ProjectTasks(&project)
 	now := time.Now()
-	var nextTasks []*godoist.Task
+	filter, err := parseSkipDeadline(cfg.SkipDeadline)
+	if err != nil {
+		logger.Warn("Ignoring invalid skip_deadline", "error", err)
+	}
+	var nextTasks, parents []*godoist.Task
 	var working_on []*godoist.Task
 	logger.Debug("Number of task in project", "project", project.Name, "#", len(tasks), "color", project.Color)
-	for _, task := range tasks {
-		if task.ParentID == "" {
-			working_on = append(working_on, task)
-		}
+	if projectDeferred(store, &project, now) {
+		logger.Debug("Project deferred", "project", project.Name)
+		return projectTraversal{deferred: true}
 	}
+	working_on = eligibleTopLevel(store, &project, tasks, cfg)
 	for len(working_on) > 0 {
 		task := working_on[0]
 		working_on = working_on[1:]
 		name := task.Content
-		subtasks := task.GetChildren()
-		//TODO: implement switch for sequential order
+		// A deferred or blocked parent hides its whole subtree.
+		if taskDeferred(task, cfg, now) {
+			logger.Debug("Task deferred", "task", name)
+			continue
+		}
+		if taskBlocked(store, task) {
+			continue
+		}
+		subtasks := store.ChildTasks(task)
 		sort.Slice(subtasks, func(i, j int) bool {
 			return subtasks[i].ChildOrder < subtasks[j].ChildOrder
 		})
 		if len(subtasks) == 0 {
-			if hasPrefix(name, cfg.SkipPrefixes) {
+			if !isActionable(task, cfg, filter, now) {
 				continue
 			}
-			if cfg.SkipDeadline == "not_overdue" && task.Deadline != nil && task.Deadline.ParsedDate.After(now) {
-				continue
-			}
-			labels := task.Labels
-			if len(cfg.IgnoreLabels) > 0 {
-				ignore := false
-				for _, label := range labels {
-					for _, ignoreLabel := range cfg.IgnoreLabels {
-						if label == ignoreLabel {
-							ignore = true
-							break
-						}
-					}
-				}
-				if ignore {
-					continue
-				}
-			}
 			nextTasks = append(nextTasks, task)
 		} else {
-			if strings.HasSuffix(name, cfg.SequentialMarker) {
-				logger.Debug("Sequential task", "tasks", subtasks, "order", subtasks[len(subtasks)-1].ChildOrder)
-				working_on = append(working_on, subtasks[len(subtasks)-1])
+			if order, ok := sequentialOrderOf(name, cfg.SequentialMarker, cfg.SequentialOrder); ok {
+				exposed := pick(order, subtasks)
+				logger.Debug("Sequential task", "task", name, "order", order, "exposed", len(exposed))
+				working_on = append(working_on, exposed...)
 			} else {
+				parents = append(parents, task)
 				working_on = append(working_on, subtasks...)
 			}
 		}
 
 	}
 
-	return nextTasks
+	if filter.surfaceOverdue {
+		nextTasks = append(nextTasks, overdueTasks(store, tasks, nextTasks, cfg, filter, now)...)
+	}
+
+	return projectTraversal{next: nextTasks, parents: parents}
+}
+
+// isActionable applies the per-task filters to a leaf task.
+func isActionable(task *godoist.Task, cfg NextItemsConfig, filter dateFilter, now time.Time) bool {
+	if hasPrefix(task.Content, cfg.SkipPrefixes) {
+		return false
+	}
+	if filter.skip(task, now) {
+		return false
+	}
+	return !hasLabel(cfg.IgnoreLabels, task)
+}
+
+// overdueTasks returns the overdue leaf tasks of a project that sequential
+// blocking kept out of next. Deferred and blocked tasks and subtrees stay hidden.
+func overdueTasks(store taskStore, tasks, next []*godoist.Task, cfg NextItemsConfig, filter dateFilter, now time.Time) []*godoist.Task {
+	var overdue []*godoist.Task
+	for _, task := range tasks {
+		if isTaskInList(task, next) || len(store.ChildTasks(task)) > 0 || !filter.overdue(task, now) {
+			continue
+		}
+		if !isActionable(task, cfg, filter, now) {
+			continue
+		}
+		deferred := false
+		for t := task; t != nil && !deferred; t = store.Task(t.ParentID) {
+			deferred = taskDeferred(t, cfg, now) || taskBlocked(store, t)
+			if t.ParentID == "" {
+				break
+			}
+		}
+		if !deferred {
+			logger.Debug("Surfacing overdue task", "task", task.Content)
+			overdue = append(overdue, task)
+		}
+	}
+	return overdue
 }
 
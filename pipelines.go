@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// pipelineNames lists the pipelines in the order run executes them by default.
+var pipelineNames = []string{"next_items", "reviews"}
+
+func verifyPipelines(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("no pipelines given")
+	}
+	for _, name := range names {
+		known := false
+		for _, p := range pipelineNames {
+			known = known || p == name
+		}
+		if !known {
+			return fmt.Errorf("unknown pipeline %q", name)
+		}
+	}
+	return nil
+}
+
+// nextItemsConfig returns the next_items configuration. The review labels are
+// retained when tasks lose their next status so the two pipelines never undo
+// each other's changes.
+func (c config) nextItemsConfig() NextItemsConfig {
+	out := c.NextItems
+	for _, label := range c.ReviewsConfig.labels() {
+		if label != "" {
+			out.retainLabels = append(out.retainLabels, label)
+		}
+	}
+	return out
+}
+
+// reviewsConfig returns the reviews configuration, inheriting the traversal
+// settings from next_items unless reviews.next_items overrides them.
+func (c config) reviewsConfig() ReviewsConfig {
+	out := c.ReviewsConfig
+	if out.NextItemsConfig.EntryPoint == "" && len(out.NextItemsConfig.Roots) == 0 {
+		out.NextItemsConfig = c.NextItems
+	}
+	return out
+}
+
+// runPipeline runs a single named pipeline against an already synced store.
+func runPipeline(name string, store taskStore, cfg *config, cs *changeSet) error {
+	switch name {
+	case "next_items":
+		process_next_items(store, cfg.nextItemsConfig(), cs)
+	case "reviews":
+		reviews(store, cfg.reviewsConfig(), cs)
+	default:
+		return fmt.Errorf("unknown pipeline %q", name)
+	}
+	return nil
+}
+
+// runPipelines syncs once, runs the pipelines in order against the same store
+// and commits once. Each pipeline sees the changes of the ones before it. In
+// dry-run mode the planned changes are printed instead of committed.
+func runPipelines(cfg *config, names []string, dryRun bool) error {
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	cs := newRunChangeSet(store, cfg, dryRun)
+	for _, name := range names {
+		logger.Debug("Running pipeline", "pipeline", name)
+		if err := runPipeline(name, store, cfg, cs); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		printChanges(os.Stdout, cs.Changes())
+		return nil
+	}
+	return store.Commit()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestRunPipelinesShareReviewLabel(t *testing.T) {
+	store := newMemoryStore(
+		[]godoist.Project{{ID: "root", Name: "projects"}},
+		[]godoist.Task{
+			{ID: "t1", Content: "*Weekly review", ProjectID: "root", Labels: []string{"next", "review"}},
+			{ID: "t2", Content: "Write report", ProjectID: "root"},
+		},
+	)
+	cfg := defaultConfig
+	cfg.NextItems.IgnoreLabels = []string{"waiting"}
+	cs := newChangeSet(store, false)
+
+	for _, name := range pipelineNames {
+		if err := runPipeline(name, store, &cfg, cs); err != nil {
+			t.Fatalf("runPipeline(%s): %v", name, err)
+		}
+	}
+
+	if got := store.Task("t1").Labels; !sameLabels(got, []string{"review"}) {
+		t.Errorf("t1 labels = %v, want [review]", got)
+	}
+	if got := store.Task("t2").Labels; !sameLabels(got, []string{"next"}) {
+		t.Errorf("t2 labels = %v, want [next]", got)
+	}
+	for _, c := range cs.Changes() {
+		if c.TaskID == "t1" && c.Field == "labels" && !sameLabels(labelsValue(c.New), []string{"review"}) {
+			t.Errorf("t1 changed to %v, review label should never be dropped", c.New)
+		}
+	}
+}
+
+func TestVerifyPipelines(t *testing.T) {
+	if err := verifyPipelines([]string{"reviews", "next_items"}); err != nil {
+		t.Errorf("verifyPipelines() error = %v", err)
+	}
+	if err := verifyPipelines([]string{"next_items", "bogus"}); err == nil {
+		t.Error("expected error for unknown pipeline")
+	}
+	if err := verifyPipelines(nil); err == nil {
+		t.Error("expected error for empty pipeline list")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+// plan is a saved set of changes computed against a snapshot of the affected
+// tasks and projects.
+type plan struct {
+	CreatedAt time.Time         `json:"created_at"`
+	Pipelines []string          `json:"pipelines"`
+	Tasks     []taskSnapshot    `json:"tasks"`
+	Projects  []projectSnapshot `json:"projects"`
+	Changes   []change          `json:"changes"`
+}
+
+// taskSnapshot is the state of a task at plan time, used to detect drift before applying.
+type taskSnapshot struct {
+	ID        string                 `json:"id"`
+	Content   string                 `json:"content"`
+	Labels    []string               `json:"labels"`
+	Priority  godoist.PRIORITY_LEVEL `json:"priority"`
+	UpdatedAt string                 `json:"updated_at"`
+}
+
+func snapshotTask(t *godoist.Task) taskSnapshot {
+	return taskSnapshot{
+		ID:        t.ID,
+		Content:   t.Content,
+		Labels:    append([]string{}, t.Labels...),
+		Priority:  t.Priority,
+		UpdatedAt: t.UpdatedAt,
+	}
+}
+
+// snapshotTasks captures the current state of all tasks, keyed by ID.
+func snapshotTasks(tasks []*godoist.Task) map[string]taskSnapshot {
+	out := make(map[string]taskSnapshot, len(tasks))
+	for _, t := range tasks {
+		out[t.ID] = snapshotTask(t)
+	}
+	return out
+}
+
+// projectSnapshot is the state of a project at plan time. Only the
+// description is changed by automadoist, so only it is checked for drift.
+type projectSnapshot struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// snapshotProjects captures the current state of all projects, keyed by ID.
+func snapshotProjects(projects []*godoist.Project) map[string]projectSnapshot {
+	out := make(map[string]projectSnapshot, len(projects))
+	for _, p := range projects {
+		out[p.ID] = projectSnapshot{ID: p.ID, Name: p.Name, Description: p.Description}
+	}
+	return out
+}
+
+// newPlan builds a plan from the recorded changes, keeping only snapshots of
+// affected tasks and projects.
+func newPlan(pipelines []string, before map[string]taskSnapshot, projects map[string]projectSnapshot, changes []change) *plan {
+	p := &plan{
+		CreatedAt: time.Now().UTC(),
+		Pipelines: pipelines,
+		Tasks:     []taskSnapshot{},
+		Projects:  []projectSnapshot{},
+		Changes:   changes,
+	}
+	seen := make(map[string]bool)
+	for _, c := range changes {
+		if c.ProjectID != "" {
+			if seen["project "+c.ProjectID] {
+				continue
+			}
+			seen["project "+c.ProjectID] = true
+			if snap, ok := projects[c.ProjectID]; ok {
+				p.Projects = append(p.Projects, snap)
+			}
+			continue
+		}
+		if seen[c.TaskID] {
+			continue
+		}
+		seen[c.TaskID] = true
+		if snap, ok := before[c.TaskID]; ok {
+			p.Tasks = append(p.Tasks, snap)
+		}
+	}
+	sort.Slice(p.Tasks, func(i, j int) bool {
+		return p.Tasks[i].ID < p.Tasks[j].ID
+	})
+	sort.Slice(p.Projects, func(i, j int) bool {
+		return p.Projects[i].ID < p.Projects[j].ID
+	})
+	return p
+}
+
+func writePlan(path string, p *plan) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func readPlan(path string) (*plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing plan %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// checkPlan verifies that every task and project affected by the plan is
+// unchanged since the plan was made.
+func checkPlan(p *plan, lookup func(id string) *godoist.Task, lookupProject func(id string) *godoist.Project) error {
+	var drifted []string
+	for _, snap := range p.Tasks {
+		t := lookup(snap.ID)
+		if t == nil {
+			drifted = append(drifted, fmt.Sprintf("%s (%s): task no longer exists", snap.Content, snap.ID))
+			continue
+		}
+		if reason := snapshotDrift(snap, t); reason != "" {
+			drifted = append(drifted, fmt.Sprintf("%s (%s): %s", snap.Content, snap.ID, reason))
+		}
+	}
+	for _, snap := range p.Projects {
+		project := lookupProject(snap.ID)
+		switch {
+		case project == nil:
+			drifted = append(drifted, fmt.Sprintf("%s (%s): project no longer exists", snap.Name, snap.ID))
+		case project.Description != snap.Description:
+			drifted = append(drifted, fmt.Sprintf("%s (%s): description changed", snap.Name, snap.ID))
+		}
+	}
+	if len(drifted) > 0 {
+		return fmt.Errorf("%d item(s) changed since the plan was made:\n  %s", len(drifted), strings.Join(drifted, "\n  "))
+	}
+	return nil
+}
+
+func snapshotDrift(snap taskSnapshot, t *godoist.Task) string {
+	switch {
+	case snap.UpdatedAt != "" && t.UpdatedAt != "" && snap.UpdatedAt != t.UpdatedAt:
+		return "updated at " + t.UpdatedAt
+	case snap.Content != t.Content:
+		return "content changed"
+	case !sameLabels(snap.Labels, t.Labels):
+		return "labels changed"
+	case snap.Priority != t.Priority:
+		return "priority changed"
+	}
+	return ""
+}
+
+// applyPlan executes the plan's changes in order. It refuses to run if any affected task has drifted.
+func applyPlan(store taskStore, p *plan, cs *changeSet) error {
+	if err := checkPlan(p, store.Task, store.Project); err != nil {
+		return err
+	}
+	for _, c := range p.Changes {
+		if c.ProjectID != "" {
+			project := store.Project(c.ProjectID)
+			if project == nil {
+				return fmt.Errorf("project not found: %s", c.ProjectID)
+			}
+			if err := applyProjectChange(cs, project, c); err != nil {
+				return fmt.Errorf("applying %s change to %q: %w", c.Field, project.Name, err)
+			}
+			continue
+		}
+		if c.Field == "created" {
+			if _, err := cs.createTask(taskValue(c.Content, c.New), c.Reason); err != nil {
+				return fmt.Errorf("creating %q: %w", c.Content, err)
+			}
+			continue
+		}
+		t := store.Task(c.TaskID)
+		if t == nil {
+			return fmt.Errorf("task not found: %s", c.TaskID)
+		}
+		if err := applyChange(cs, t, c); err != nil {
+			return fmt.Errorf("applying %s change to %q: %w", c.Field, t.Content, err)
+		}
+	}
+	return nil
+}
+
+// applyChange sets the change's new value on the task.
+func applyChange(cs *changeSet, t *godoist.Task, c change) error {
+	switch c.Field {
+	case "labels":
+		return cs.setLabels(t, labelsValue(c.New), c.Reason)
+	case "priority":
+		return cs.setPriority(t, priorityValue(c.New), c.Reason)
+	case "context":
+		if c.New == nil {
+			return cs.deleteContext(t, contextValue(c.Old), c.Reason)
+		}
+		return cs.setContext(t, contextValue(c.Old), contextValue(c.New), c.Reason)
+	default:
+		return fmt.Errorf("unknown field %q", c.Field)
+	}
+}
+
+// applyProjectChange sets the change's new value on the project.
+func applyProjectChange(cs *changeSet, p *godoist.Project, c change) error {
+	switch c.Field {
+	case "description":
+		return cs.setProjectDescription(p, stringValue(c.New), c.Reason)
+	default:
+		return fmt.Errorf("unknown project field %q", c.Field)
+	}
+}
+
+// labelsValue converts a recorded label value, either in-process or decoded from JSON.
+func labelsValue(v interface{}) []string {
+	switch val := v.(type) {
+	case []string:
+		return val
+	case []interface{}:
+		labels := make([]string, 0, len(val))
+		for _, l := range val {
+			if s, ok := l.(string); ok {
+				labels = append(labels, s)
+			}
+		}
+		return labels
+	}
+	return []string{}
+}
+
+// priorityValue converts a recorded priority value, either in-process or decoded from JSON.
+func priorityValue(v interface{}) godoist.PRIORITY_LEVEL {
+	switch p := v.(type) {
+	case godoist.PRIORITY_LEVEL:
+		return p
+	case float64:
+		return godoist.PRIORITY_LEVEL(int(p))
+	case int:
+		return godoist.PRIORITY_LEVEL(p)
+	}
+	return godoist.VERY_LOW
+}
+
+func boolValue(v interface{}) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+func stringValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func contextValue(v interface{}) map[string]interface{} {
+	if ctx, ok := v.(map[string]interface{}); ok {
+		return ctx
+	}
+	return map[string]interface{}{}
+}
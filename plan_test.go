@@ -0,0 +1,143 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestPlanRoundTrip(t *testing.T) {
+	task := &godoist.Task{ID: "1", Content: "Buy milk", Labels: []string{"home"}, Priority: godoist.VERY_LOW, UpdatedAt: "2026-01-01T00:00:00Z"}
+	before := snapshotTasks([]*godoist.Task{task, {ID: "2", Content: "untouched"}})
+
+	cs := newChangeSet(nil, true)
+	cs.setLabels(task, []string{"home", "next"}, "next action")
+	cs.setPriority(task, godoist.MEDIUM, "project color red")
+	cs.setContext(task, nil, contextMap([]string{"home"}, godoist.HIGH), "saving customized context")
+
+	p := newPlan([]string{"next_items"}, before, nil, cs.Changes())
+	if len(p.Tasks) != 1 || p.Tasks[0].ID != "1" {
+		t.Fatalf("Tasks = %v, want only task 1", p.Tasks)
+	}
+	if !reflect.DeepEqual(p.Tasks[0].Labels, []string{"home"}) {
+		t.Errorf("snapshot labels = %v, want pre-change [home]", p.Tasks[0].Labels)
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := writePlan(path, p); err != nil {
+		t.Fatalf("writePlan: %v", err)
+	}
+	loaded, err := readPlan(path)
+	if err != nil {
+		t.Fatalf("readPlan: %v", err)
+	}
+	if len(loaded.Changes) != 3 {
+		t.Fatalf("got %d changes, want 3", len(loaded.Changes))
+	}
+
+	// Replay the decoded plan against a fresh copy of the original task.
+	fresh := &godoist.Task{ID: "1", Content: "Buy milk", Labels: []string{"home"}, Priority: godoist.VERY_LOW, UpdatedAt: "2026-01-01T00:00:00Z"}
+	if err := checkPlan(loaded, func(string) *godoist.Task { return fresh }, nil); err != nil {
+		t.Fatalf("checkPlan: %v", err)
+	}
+	replay := newChangeSet(nil, true)
+	for _, c := range loaded.Changes {
+		if err := applyChange(replay, fresh, c); err != nil {
+			t.Fatalf("applyChange: %v", err)
+		}
+	}
+	if !sameLabels(fresh.Labels, []string{"home", "next"}) {
+		t.Errorf("Labels = %v, want [home next]", fresh.Labels)
+	}
+	if fresh.Priority != godoist.MEDIUM {
+		t.Errorf("Priority = %v, want Medium", fresh.Priority)
+	}
+	ctx := contextValue(replay.Changes()[2].New)
+	if priorityValue(ctx["priority"]) != godoist.HIGH {
+		t.Errorf("context priority = %v, want High", ctx["priority"])
+	}
+}
+
+func TestCheckPlan(t *testing.T) {
+	p := &plan{Tasks: []taskSnapshot{
+		{ID: "1", Content: "Buy milk", Labels: []string{"home"}, Priority: godoist.VERY_LOW, UpdatedAt: "t1"},
+	}}
+	tests := []struct {
+		name    string
+		task    *godoist.Task
+		wantErr string
+	}{
+		{"unchanged", &godoist.Task{ID: "1", Content: "Buy milk", Labels: []string{"home"}, Priority: godoist.VERY_LOW, UpdatedAt: "t1"}, ""},
+		{"missing", nil, "no longer exists"},
+		{"updated", &godoist.Task{ID: "1", Content: "Buy milk", Labels: []string{"home"}, Priority: godoist.VERY_LOW, UpdatedAt: "t2"}, "updated at t2"},
+		{"labels", &godoist.Task{ID: "1", Content: "Buy milk", Labels: []string{"work"}, Priority: godoist.VERY_LOW}, "labels changed"},
+		{"priority", &godoist.Task{ID: "1", Content: "Buy milk", Labels: []string{"home"}, Priority: godoist.HIGH}, "priority changed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPlan(p, func(string) *godoist.Task { return tt.task }, nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlanApplyReviewCadence(t *testing.T) {
+	account := func() *memoryStore {
+		return newMemoryStore(
+			[]godoist.Project{
+				{ID: "root", Name: "projects"},
+				{ID: "trip", Name: "Trip", ParentID: "root", Description: "Summer trip [automadoist:review=7d]"},
+			},
+			[]godoist.Task{
+				{ID: "t1", Content: "*Review Trip", ProjectID: "trip"},
+				{ID: "t2", Content: "Book hotel", ProjectID: "trip"},
+			},
+		)
+	}
+	store := account()
+	before, projects := snapshotTasks(store.Tasks()), snapshotProjects(store.Projects())
+	cs := newChangeSet(store, true)
+	reviews(store, defaultReviewsConfig(defaultNextItemsConfig()), cs)
+
+	p := newPlan([]string{"reviews"}, before, projects, cs.Changes())
+	if len(p.Projects) != 1 || p.Projects[0].Description != "Summer trip [automadoist:review=7d]" {
+		t.Fatalf("Projects = %+v, want the pre-change trip description", p.Projects)
+	}
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := writePlan(path, p); err != nil {
+		t.Fatalf("writePlan: %v", err)
+	}
+	loaded, err := readPlan(path)
+	if err != nil {
+		t.Fatalf("readPlan: %v", err)
+	}
+
+	fresh := account()
+	if err := applyPlan(fresh, loaded, newChangeSet(fresh, false)); err != nil {
+		t.Fatalf("applyPlan: %v", err)
+	}
+	if got := fresh.Project("trip").Description; !strings.Contains(got, "review_task=t1") {
+		t.Errorf("description = %q, want review_task recorded", got)
+	}
+	if got := fresh.Task("t1").Labels; !sameLabels(got, []string{"review"}) {
+		t.Errorf("t1 labels = %v, want [review]", got)
+	}
+
+	edited := account()
+	edited.Project("trip").Description = "Winter trip [automadoist:review=7d]"
+	err = applyPlan(edited, loaded, newChangeSet(edited, false))
+	if err == nil || !strings.Contains(err.Error(), "description changed") {
+		t.Errorf("applyPlan on edited project = %v, want description drift", err)
+	}
+}
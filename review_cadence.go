@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+// parseTimestamp parses a last_reviewed value: RFC 3339, or a plain date in
+// local time.
+func parseTimestamp(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return parseDeferDate(value)
+}
+
+func validateReviewValue(value string) error {
+	d, err := parseDuration(value)
+	if err == nil && d == 0 {
+		err = fmt.Errorf("review interval must be positive")
+	}
+	return err
+}
+
+func validateTimestampValue(value string) error {
+	_, err := parseTimestamp(value)
+	return err
+}
+
+func validateTaskIDValue(value string) error {
+	if !taskIDRegex.MatchString(value) {
+		return fmt.Errorf("not a task ID: %q", value)
+	}
+	return nil
+}
+
+// reviewContent returns the content of a project's review task.
+func reviewContent(cfg ReviewsConfig, p *godoist.Project) string {
+	return strings.ReplaceAll(cfg.TaskContent, "{project}", p.Name)
+}
+
+// reviewCadence keeps the review tasks of projects with a
+// "[automadoist:review=7d]" interval. Once the review task recorded in
+// "review_task" is completed, the time is stored in "last_reviewed"; when the
+// interval has elapsed since then, a labeled review task is created, or an
+// open task with the same content is labeled again. It returns the open
+// review tasks, including new ones, so they keep their label. New tasks get
+// label.
+func reviewCadence(store taskStore, cfg ReviewsConfig, label string, cs *changeSet, projects []godoist.Project, now time.Time) []*godoist.Task {
+	var pending []*godoist.Task
+	for i := range projects {
+		p := store.Project(projects[i].ID)
+		if p == nil {
+			continue
+		}
+		m := parseMetadata(p.Description)
+		value, ok := m.get("review")
+		if !ok {
+			continue
+		}
+		interval, err := parseDuration(value)
+		if err != nil || interval == 0 {
+			logger.Warn("Ignoring invalid review interval", "project", p.Name, "review", value)
+			continue
+		}
+
+		if id, ok := m.get("review_task"); ok {
+			task := store.Task(id)
+			if task != nil && !task.Checked {
+				pending = append(pending, task)
+				continue
+			}
+			completed := task != nil
+			if !completed {
+				if completed, err = store.TaskCompleted(id); err != nil {
+					logger.Error("Failed to look up review task", "project", p.Name, "task", id, "error", err)
+					continue
+				}
+			}
+			m.remove("review_task")
+			if completed {
+				logger.Info("Project reviewed", "project", p.Name)
+				m.set("last_reviewed", now.Format(time.RFC3339))
+				if err := cs.setProjectDescription(p, m.String(), "review completed"); err != nil {
+					logger.Error("Failed to record review", "project", p.Name, "error", err)
+				}
+				continue
+			}
+			// A deleted review task does not count as a review; the review
+			// is still due.
+			logger.Warn("Review task no longer exists, scheduling a new one", "project", p.Name, "task", id)
+			if err := cs.setProjectDescription(p, m.String(), "review task deleted"); err != nil {
+				logger.Error("Failed to drop review task", "project", p.Name, "error", err)
+				continue
+			}
+		}
+
+		if last, ok := m.get("last_reviewed"); ok {
+			if at, err := parseTimestamp(last); err == nil && now.Before(at.Add(interval)) {
+				continue
+			}
+		}
+		if projectDeferred(store, p, now) {
+			continue
+		}
+
+		task := existingReviewTask(store, p, reviewContent(cfg, p))
+		if task == nil {
+			task, err = cs.createTask(godoist.Task{Content: reviewContent(cfg, p), ProjectID: p.ID, Labels: []string{label}}, "review due")
+			if err != nil {
+				logger.Error("Failed to create review task", "project", p.Name, "error", err)
+				continue
+			}
+		}
+		if task.ID == "" {
+			// Dry run: nothing was created to record.
+			continue
+		}
+		pending = append(pending, task)
+		m.set("review_task", task.ID)
+		if err := cs.setProjectDescription(p, m.String(), "review due"); err != nil {
+			logger.Error("Failed to record review task", "project", p.Name, "error", err)
+		}
+	}
+	return pending
+}
+
+// existingReviewTask returns an open top-level task of the project with the
+// review content, such as a recurring review the user keeps around.
+func existingReviewTask(store taskStore, p *godoist.Project, content string) *godoist.Task {
+	for _, task := range store.ProjectTasks(p) {
+		if task.ParentID == "" && task.Content == content && !task.Checked {
+			return task
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestReviewCadence(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	store := newMemoryStore(
+		[]godoist.Project{
+			{ID: "due", Name: "Garden", Description: "Beds\n[automadoist:review=7d]"},
+			{ID: "recent", Name: "Car", Description: "[automadoist:review=2w;last_reviewed=2026-10-10T09:00:00Z]"},
+			{ID: "recurring", Name: "Finances", Description: "[automadoist:review=1w]"},
+			{ID: "plain", Name: "Inbox"},
+		},
+		[]godoist.Task{
+			{ID: "standing", Content: "*Review Finances", ProjectID: "recurring"},
+		},
+	)
+	cfg := defaultReviewsConfig(defaultNextItemsConfig())
+	projects := []godoist.Project{*store.Project("due"), *store.Project("recent"), *store.Project("recurring"), *store.Project("plain")}
+
+	pending := reviewCadence(store, cfg, "review", newChangeSet(store, false), projects, now)
+	if len(pending) != 2 {
+		t.Fatalf("pending = %v, want the new Garden task and the standing Finances task", pending)
+	}
+	created := pending[0]
+	if created.Content != "*Review Garden" || created.ProjectID != "due" || !sameLabels(created.Labels, []string{"review"}) {
+		t.Errorf("created = %+v", created)
+	}
+	if got := store.Project("due").Description; got != "Beds\n[automadoist:review=7d;review_task="+created.ID+"]" {
+		t.Errorf("Garden description = %q", got)
+	}
+	if got, _ := parseMetadata(store.Project("recurring").Description).get("review_task"); got != "standing" {
+		t.Errorf("Finances review_task = %q, want the standing task", got)
+	}
+	if got := store.Project("recent").Description; got != "[automadoist:review=2w;last_reviewed=2026-10-10T09:00:00Z]" {
+		t.Errorf("Car description = %q, want untouched", got)
+	}
+
+	// A pending review is kept, not duplicated.
+	if again := reviewCadence(store, cfg, "review", newChangeSet(store, false), projects, now); len(again) != 2 {
+		t.Errorf("second run pending = %v", again)
+	}
+
+	// Completing the review records when it happened.
+	store.Task(created.ID).Checked = true
+	later := now.Add(24 * time.Hour)
+	reviewCadence(store, cfg, "review", newChangeSet(store, false), projects, later)
+	m := parseMetadata(store.Project("due").Description)
+	if m.has("review_task") {
+		t.Errorf("review_task still set: %q", store.Project("due").Description)
+	}
+	if got, _ := m.get("last_reviewed"); got != later.Format(time.RFC3339) {
+		t.Errorf("last_reviewed = %q", got)
+	}
+
+	// The next review is due once the interval has passed again.
+	projects[0] = *store.Project("due")
+	if got := reviewCadence(store, cfg, "review", newChangeSet(store, false), projects[:1], later.Add(6*24*time.Hour)); len(got) != 0 {
+		t.Errorf("review before interval = %v", got)
+	}
+	if got := reviewCadence(store, cfg, "review", newChangeSet(store, false), projects[:1], later.Add(7*24*time.Hour)); len(got) != 1 {
+		t.Errorf("review after interval = %v, want a new task", got)
+	}
+}
+
+func TestReviewCadenceDeletedTask(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	const description = "[automadoist:review=7d;last_reviewed=2026-10-01T09:00:00Z;review_task=gone]"
+	store := newMemoryStore(
+		[]godoist.Project{
+			{ID: "deleted", Name: "Garden", Description: description},
+			{ID: "done", Name: "Car", Description: "[automadoist:review=7d;review_task=closed]"},
+		},
+		[]godoist.Task{{ID: "closed", Content: "*Review Car", ProjectID: "done"}},
+	)
+	store.CloseTask(store.Task("closed"))
+	cfg := defaultReviewsConfig(defaultNextItemsConfig())
+	projects := []godoist.Project{*store.Project("deleted"), *store.Project("done")}
+
+	pending := reviewCadence(store, cfg, "review", newChangeSet(store, false), projects, now)
+
+	if len(pending) != 1 || pending[0].Content != "*Review Garden" {
+		t.Fatalf("pending = %v, want a new Garden review", pending)
+	}
+	m := parseMetadata(store.Project("deleted").Description)
+	if got, _ := m.get("last_reviewed"); got != "2026-10-01T09:00:00Z" {
+		t.Errorf("Garden last_reviewed = %q, want untouched", got)
+	}
+	if got, _ := m.get("review_task"); got != pending[0].ID {
+		t.Errorf("Garden review_task = %q, want the new task %q", got, pending[0].ID)
+	}
+	// A review task that was completed, but is no longer synced, still counts.
+	if got, _ := parseMetadata(store.Project("done").Description).get("last_reviewed"); got != now.Format(time.RFC3339) {
+		t.Errorf("Car last_reviewed = %q, want the completion recorded", got)
+	}
+}
+
+func TestReviewsKeepCadenceLabel(t *testing.T) {
+	store := newMemoryStore(
+		[]godoist.Project{
+			{ID: "root", Name: "projects"},
+			{ID: "p", Name: "Garden", ParentID: "root", Description: "[automadoist:review=7d]"},
+		},
+		[]godoist.Task{{ID: "t", Content: "Water", ProjectID: "p"}},
+	)
+	cfg := defaultReviewsConfig(defaultNextItemsConfig())
+
+	reviews(store, cfg, newChangeSet(store, false))
+	reviews(store, cfg, newChangeSet(store, false))
+
+	var labeled []string
+	for _, task := range store.Tasks() {
+		if hasLabel([]string{"review"}, task) {
+			labeled = append(labeled, task.Content)
+		}
+	}
+	if !sameLabels(labeled, []string{"*Review Garden"}) {
+		t.Errorf("review-labeled tasks = %v", labeled)
+	}
+}
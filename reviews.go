@@ -1,15 +1,37 @@
 package main
 
 import (
+	"slices"
+	"time"
+
 	"github.com/harlequix/godoist"
 )
 
+// ReviewRule maps task prefixes to the label, and optionally the priority,
+// given to review tasks starting with one of them.
+type ReviewRule struct {
+	Prefixes []string `koanf:"prefixes"`
+	Label    string   `koanf:"label"`
+	// Priority is set when the label is added and reverted when it is
+	// removed; 0 leaves it alone.
+	Priority int `koanf:"priority"`
+}
+
+// reviewPriorityKey is the context key holding the priority a review task had
+// before its rule's priority was set.
+const reviewPriorityKey = "review_priority"
+
 type ReviewsConfig struct {
 	Prefixes        []string        `koanf:"prefixes"`
 	Purge           bool            `koanf:"purge"`
 	Label           string          `koanf:"label"`
 	NextItemsConfig NextItemsConfig `koanf:"next_items"`
 	Clean           bool            `koanf:"clean"`
+	// TaskContent is the content of review tasks created for projects with a
+	// review interval; "{project}" is replaced by the project name.
+	TaskContent string `koanf:"task_content"`
+	// Rules replace Prefixes and Label when set.
+	Rules []ReviewRule `koanf:"rules"`
 }
 
 func defaultReviewsConfig(cfg NextItemsConfig) ReviewsConfig {
@@ -20,23 +42,67 @@ func defaultReviewsConfig(cfg NextItemsConfig) ReviewsConfig {
 		Label:           "review",
 		NextItemsConfig: cfg,
 		Clean:           true,
+		TaskContent:     "*Review {project}",
+	}
+}
+
+// rules returns the configured review rules, or a single rule made of
+// Prefixes and Label.
+func (c ReviewsConfig) rules() []ReviewRule {
+	if len(c.Rules) > 0 {
+		return c.Rules
 	}
+	return []ReviewRule{{Prefixes: c.Prefixes, Label: c.Label}}
+}
+
+// labels returns the labels of all review rules.
+func (c ReviewsConfig) labels() []string {
+	var labels []string
+	for _, rule := range c.rules() {
+		labels = append(labels, rule.Label)
+	}
+	return labels
+}
+
+// ruleWithLabel returns the rule adding label, or nil.
+func (c ReviewsConfig) ruleWithLabel(label string) *ReviewRule {
+	rules := c.rules()
+	for i := range rules {
+		if rules[i].Label == label {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// ruleFor returns the first rule with a prefix of content, or nil.
+func (c ReviewsConfig) ruleFor(content string) *ReviewRule {
+	rules := c.rules()
+	for i := range rules {
+		if hasPrefix(content, rules[i].Prefixes) {
+			return &rules[i]
+		}
+	}
+	return nil
 }
 
 func prepare(cfg ReviewsConfig, nextItemsConfig NextItemsConfig) NextItemsConfig {
 	out := nextItemsConfig
-	for _, prefix := range cfg.Prefixes {
-		var filtered []string
-		for _, skip := range out.SkipPrefixes {
-			if skip != prefix {
-				filtered = append(filtered, skip)
-			}
-		}
-		out.SkipPrefixes = filtered
+	var prefixes []string
+	for _, rule := range cfg.rules() {
+		prefixes = append(prefixes, rule.Prefixes...)
 	}
 	var filtered []string
+	for _, skip := range out.SkipPrefixes {
+		if !slices.Contains(prefixes, skip) {
+			filtered = append(filtered, skip)
+		}
+	}
+	out.SkipPrefixes = filtered
+	labels := cfg.labels()
+	filtered = nil
 	for _, label := range out.IgnoreLabels {
-		if label != cfg.Label {
+		if !slices.Contains(labels, label) {
 			filtered = append(filtered, label)
 		}
 	}
@@ -44,55 +110,127 @@ func prepare(cfg ReviewsConfig, nextItemsConfig NextItemsConfig) NextItemsConfig
 	return out
 }
 
-func reviews(client *godoist.Todoist, cfg ReviewsConfig) {
-	entry_search := client.Projects.GetByName(cfg.NextItemsConfig.EntryPoint)
-	if len(entry_search) != 1 {
-		logger.Error("Entry point not found")
+func reviews(store taskStore, cfg ReviewsConfig, cs *changeSet) {
+	scopes := resolveRoots(store, cfg.NextItemsConfig)
+	if len(scopes) == 0 {
 		return
 	}
-	NextItemsConfig := prepare(cfg, cfg.NextItemsConfig)
-
-	entry := entry_search[0]
-	projects := collectProjects(*entry)
-	logger.Info("Processing reviews", "config", NextItemsConfig)
+	var projects []godoist.Project
 	var next_items []*godoist.Task
-	for _, project := range projects {
-		tasks := getNextTasks(project, NextItemsConfig)
-		next_items = append(next_items, tasks...)
+	for _, scope := range scopes {
+		NextItemsConfig := prepare(cfg, scope.cfg)
+		logger.Info("Processing reviews", "config", NextItemsConfig)
+		for _, project := range scope.projects {
+			tasks := getNextTasks(store, project, NextItemsConfig)
+			next_items = append(next_items, tasks...)
+		}
+		projects = append(projects, scope.projects...)
 	}
-	needsReviewTasks := []*godoist.Task{}
+	// matched maps each review task to the rule whose label it should carry.
+	matched := map[string]*ReviewRule{}
 	reviewTasks := []*godoist.Task{}
 	for _, item := range next_items {
 		logger.Debug("Processing item", "item", item)
-		if hasPrefix(item.Content, cfg.Prefixes) {
+		if rule := cfg.ruleFor(item.Content); rule != nil && matched[item.ID] == nil {
+			matched[item.ID] = rule
 			reviewTasks = append(reviewTasks, item)
-			if !hasLabel([]string{cfg.Label}, item) {
-				logger.Debug("Adding label", "label", cfg.Label, "item", item)
-				needsReviewTasks = append(needsReviewTasks, item)
-			}
 		}
 	}
 
+	cadenceRule := cfg.ruleFor(cfg.TaskContent)
+	if cadenceRule == nil {
+		cadenceRule = &cfg.rules()[0]
+	}
+	for _, task := range reviewCadence(store, cfg, cadenceRule.Label, cs, projects, time.Now()) {
+		if matched[task.ID] != nil {
+			continue
+		}
+		if rule := cfg.ruleFor(task.Content); rule != nil {
+			matched[task.ID] = rule
+		} else {
+			matched[task.ID] = cadenceRule
+		}
+		reviewTasks = append(reviewTasks, task)
+	}
+
 	var comparing = []*godoist.Task{}
 	if cfg.Purge {
-		comparing = client.Tasks.All()
+		comparing = store.Tasks()
 	} else if cfg.Clean {
-		comparing = GetTasks(projects)
+		comparing = GetTasks(store, projects)
 	}
+	labels := cfg.labels()
 	var toRemove []*godoist.Task
 	for _, task := range comparing {
-		if hasLabel([]string{cfg.Label}, task) && !isTaskInList(task, reviewTasks) {
-			toRemove = append(toRemove, task)
+		for _, label := range labels {
+			if hasLabel([]string{label}, task) && (matched[task.ID] == nil || matched[task.ID].Label != label) {
+				toRemove = append(toRemove, task)
+				break
+			}
 		}
 	}
 	runParallel(toRemove, func(task *godoist.Task) {
-		logger.Debug("Removing label", "label", cfg.Label, "task", task)
-		if err := task.RemoveLabel(cfg.Label); err != nil {
-			logger.Error("Failed to remove label", "label", cfg.Label, "task", task.Content, "error", err)
+		for _, label := range labels {
+			if !hasLabel([]string{label}, task) || (matched[task.ID] != nil && matched[task.ID].Label == label) {
+				continue
+			}
+			logger.Debug("Removing label", "label", label, "task", task)
+			if err := cs.removeLabel(task, label, "no longer a review task"); err != nil {
+				logger.Error("Failed to remove label", "label", label, "task", task.Content, "error", err)
+				continue
+			}
+			revertReviewPriority(cfg.ruleWithLabel(label), cs, task)
 		}
 	})
+	var needsReviewTasks []*godoist.Task
+	for _, task := range reviewTasks {
+		if !hasLabel([]string{matched[task.ID].Label}, task) {
+			needsReviewTasks = append(needsReviewTasks, task)
+		}
+	}
 	runParallel(needsReviewTasks, func(task *godoist.Task) {
-		task.AddLabel(cfg.Label)
+		rule := matched[task.ID]
+		logger.Debug("Adding label", "label", rule.Label, "task", task)
+		if err := cs.addLabel(task, rule.Label, "review task"); err != nil {
+			logger.Error("Failed to add label", "label", rule.Label, "task", task.Content, "error", err)
+			return
+		}
+		if rule.Priority == 0 || task.Priority == godoist.PRIORITY_LEVEL(rule.Priority) {
+			return
+		}
+		original := task.Priority
+		if err := cs.setPriority(task, godoist.PRIORITY_LEVEL(rule.Priority), "review task"); err != nil {
+			logger.Error("Failed to set priority", "priority", rule.Priority, "task", task.Content, "error", err)
+			return
+		}
+		if err := cs.updateContext(task, map[string]interface{}{reviewPriorityKey: int(original)}, "review task"); err != nil {
+			logger.Error("Failed to update context", "task", task.Content, "error", err)
+		}
 	})
+}
 
+// revertReviewPriority restores the priority a task had before rule set its
+// priority, unless it was changed by hand since.
+func revertReviewPriority(rule *ReviewRule, cs *changeSet, task *godoist.Task) {
+	if rule == nil || rule.Priority == 0 {
+		return
+	}
+	ctx, err := cs.context(task)
+	if err != nil {
+		logger.Error("Failed to read context", "task", task.Content, "error", err)
+		return
+	}
+	raw, ok := ctx[reviewPriorityKey]
+	if !ok {
+		return
+	}
+	if task.Priority == godoist.PRIORITY_LEVEL(rule.Priority) {
+		if err := cs.setPriority(task, priorityValue(raw), "no longer a review task"); err != nil {
+			logger.Error("Failed to update priority", "task", task.Content, "error", err)
+			return
+		}
+	}
+	if err := cs.updateContext(task, map[string]interface{}{reviewPriorityKey: nil}, "no longer a review task"); err != nil {
+		logger.Error("Failed to update context", "task", task.Content, "error", err)
+	}
 }
@@ -2,6 +2,8 @@ package main
 
 import (
 	"testing"
+
+	"github.com/harlequix/godoist"
 )
 
 func TestPrepare(t *testing.T) {
@@ -84,4 +86,114 @@ func TestPrepare(t *testing.T) {
 			t.Errorf("IgnoreLabels = %v, want [waiting]", got.IgnoreLabels)
 		}
 	})
+
+	t.Run("removes prefixes and labels of all rules", func(t *testing.T) {
+		reviewCfg := ReviewsConfig{
+			Prefixes: []string{"#"},
+			Label:    "unused",
+			Rules: []ReviewRule{
+				{Prefixes: []string{"*"}, Label: "review"},
+				{Prefixes: []string{"?"}, Label: "decide"},
+			},
+		}
+		nextCfg := NextItemsConfig{
+			SkipPrefixes: []string{"*", "?", "#"},
+			IgnoreLabels: []string{"waiting", "review", "decide", "unused"},
+		}
+		got := prepare(reviewCfg, nextCfg)
+
+		if !sameLabels(got.SkipPrefixes, []string{"#"}) {
+			t.Errorf("SkipPrefixes = %v, want [#]", got.SkipPrefixes)
+		}
+		if !sameLabels(got.IgnoreLabels, []string{"waiting", "unused"}) {
+			t.Errorf("IgnoreLabels = %v, want [waiting unused]", got.IgnoreLabels)
+		}
+	})
+}
+
+func TestReviewRules(t *testing.T) {
+	store := newMemoryStore(
+		[]godoist.Project{{ID: "root", Name: "projects"}},
+		[]godoist.Task{
+			{ID: "review", Content: "*Check budget", ProjectID: "root", ChildOrder: 1},
+			{ID: "decide", Content: "?Pick a school", ProjectID: "root", ChildOrder: 2},
+			{ID: "read", Content: "%Style guide", ProjectID: "root", ChildOrder: 3, Labels: []string{"review"}},
+			{ID: "plain", Content: "Call mom", ProjectID: "root", ChildOrder: 4, Labels: []string{"read"}},
+		},
+	)
+	cfg := defaultReviewsConfig(defaultNextItemsConfig())
+	cfg.Rules = []ReviewRule{
+		{Prefixes: []string{"*"}, Label: "review"},
+		{Prefixes: []string{"?"}, Label: "decide", Priority: 3},
+		{Prefixes: []string{"%"}, Label: "read"},
+	}
+	cfg.NextItemsConfig.SkipPrefixes = []string{"*", "?", "%"}
+
+	reviews(store, cfg, newChangeSet(store, false))
+
+	want := map[string][]string{
+		"review": {"review"},
+		"decide": {"decide"},
+		"read":   {"read"},
+		"plain":  nil,
+	}
+	for id, labels := range want {
+		if got := store.Task(id).Labels; !sameLabels(got, labels) || len(got) != len(labels) {
+			t.Errorf("%s labels = %v, want %v", id, got, labels)
+		}
+	}
+	if got := store.Task("decide").Priority; got != godoist.PRIORITY_LEVEL(3) {
+		t.Errorf("decide priority = %v, want 3", got)
+	}
+	if got := store.Task("review").Priority; got != 0 {
+		t.Errorf("review priority = %v, want unchanged", got)
+	}
+}
+
+func TestReviewRulePriorityReverted(t *testing.T) {
+	tests := []struct {
+		name      string
+		setByHand godoist.PRIORITY_LEVEL
+		want      godoist.PRIORITY_LEVEL
+	}{
+		{"reverted", 0, 2},
+		{"changed by hand", 4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore(
+				[]godoist.Project{{ID: "root", Name: "projects"}},
+				[]godoist.Task{{ID: "decide", Content: "?Pick a school", ProjectID: "root", Priority: 2}},
+			)
+			cfg := defaultReviewsConfig(defaultNextItemsConfig())
+			cfg.Rules = []ReviewRule{
+				{Prefixes: []string{"*"}, Label: "review"},
+				{Prefixes: []string{"?"}, Label: "decide", Priority: 3},
+			}
+			cfg.NextItemsConfig.SkipPrefixes = []string{"*", "?"}
+
+			reviews(store, cfg, newChangeSet(store, false))
+			task := store.Task("decide")
+			if task.Priority != 3 {
+				t.Fatalf("priority = %v, want 3 while labeled", task.Priority)
+			}
+			if tt.setByHand != 0 {
+				task.Priority = tt.setByHand
+			}
+			task.Content = "Pick a school"
+			cs := newChangeSet(store, false)
+			reviews(store, cfg, cs)
+
+			if len(task.Labels) != 0 {
+				t.Errorf("labels = %v, want none", task.Labels)
+			}
+			if task.Priority != tt.want {
+				t.Errorf("priority = %v, want %v", task.Priority, tt.want)
+			}
+			ctx, _ := cs.context(task)
+			if _, ok := ctx[reviewPriorityKey]; ok {
+				t.Errorf("context = %v, want %s removed", ctx, reviewPriorityKey)
+			}
+		})
+	}
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/harlequix/godoist"
+)
+
+// RootConfig is one entry point of next_items. Settings left unset inherit
+// the next_items values.
+type RootConfig struct {
+	Project       string         `koanf:"project"`
+	ManagedLabels []string       `koanf:"managed_labels"`
+	SkipPrefixes  []string       `koanf:"skip_prefixes"`
+	IgnoreLabels  []string       `koanf:"ignore_labels"`
+	ColorPriority map[string]int `koanf:"color_priority"`
+}
+
+func (r RootConfig) verify() error {
+	if r.Project == "" {
+		return fmt.Errorf("project must not be empty")
+	}
+	if r.ManagedLabels != nil && len(r.ManagedLabels) == 0 {
+		return fmt.Errorf("%s: managed_labels must contain at least one label", r.Project)
+	}
+	return nil
+}
+
+// rootConfigs returns one configuration per entry point: entry_point alone,
+// or each of roots with its overrides applied.
+func (c NextItemsConfig) rootConfigs() []NextItemsConfig {
+	if len(c.Roots) == 0 {
+		return []NextItemsConfig{c}
+	}
+	out := make([]NextItemsConfig, 0, len(c.Roots))
+	for _, r := range c.Roots {
+		rc := c
+		rc.Roots = nil
+		rc.EntryPoint = r.Project
+		if r.ManagedLabels != nil {
+			rc.ManagedLabels = r.ManagedLabels
+		}
+		if r.SkipPrefixes != nil {
+			rc.SkipPrefixes = r.SkipPrefixes
+		}
+		if r.IgnoreLabels != nil {
+			rc.IgnoreLabels = r.IgnoreLabels
+		}
+		if r.ColorPriority != nil {
+			rc.ColorPriority = r.ColorPriority
+		}
+		out = append(out, rc)
+	}
+	return out
+}
+
+// resolveProject finds a project by ID, by a slash-separated path from a
+// top-level project such as "Work/Clients", or by a unique name.
+func resolveProject(store taskStore, ref string) (*godoist.Project, error) {
+	if p := store.Project(ref); p != nil {
+		return p, nil
+	}
+	if strings.Contains(ref, "/") {
+		var matches []*godoist.Project
+		for _, p := range store.Projects() {
+			if p.ParentID == "" {
+				matches = append(matches, p)
+			}
+		}
+		for i, name := range strings.Split(ref, "/") {
+			var next []*godoist.Project
+			for _, p := range matches {
+				if i > 0 {
+					for _, c := range store.ChildProjects(p) {
+						if c.Name == name {
+							next = append(next, c)
+						}
+					}
+				} else if p.Name == name {
+					next = append(next, p)
+				}
+			}
+			matches = next
+		}
+		return uniqueProject(ref, matches)
+	}
+	return uniqueProject(ref, store.ProjectsByName(ref))
+}
+
+func uniqueProject(ref string, matches []*godoist.Project) (*godoist.Project, error) {
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return nil, fmt.Errorf("project %q not found", ref)
+	default:
+		return nil, fmt.Errorf("project %q is ambiguous (%d matches); use its ID or path", ref, len(matches))
+	}
+}
+
+// rootScope is an entry point together with the projects it evaluates.
+type rootScope struct {
+	cfg      NextItemsConfig
+	entry    *godoist.Project
+	projects []godoist.Project
+}
+
+// resolveRoots resolves the entry points of cfg. When roots are nested, a
+// project belongs only to the innermost one. Roots that cannot be resolved are
+// logged and skipped.
+func resolveRoots(store taskStore, cfg NextItemsConfig) []rootScope {
+	var scopes []rootScope
+	seen := map[string]bool{}
+	for _, rc := range cfg.rootConfigs() {
+		entry, err := resolveProject(store, rc.EntryPoint)
+		if err != nil {
+			logger.Error("Entry point not found", "entry_point", rc.EntryPoint, "error", err)
+			continue
+		}
+		if seen[entry.ID] {
+			logger.Warn("Skipping duplicate entry point", "entry_point", rc.EntryPoint)
+			continue
+		}
+		seen[entry.ID] = true
+		scopes = append(scopes, rootScope{cfg: rc, entry: entry, projects: collectProjectsDepth(store, *entry, rc.projectDepth())})
+	}
+	for i := range scopes {
+		var inner []*godoist.Project
+		for j, other := range scopes {
+			if i != j && isInSubtree(store, other.entry, scopes[i].entry) {
+				inner = append(inner, other.entry)
+			}
+		}
+		if len(inner) == 0 {
+			continue
+		}
+		var own []godoist.Project
+		for _, p := range scopes[i].projects {
+			nested := false
+			for _, root := range inner {
+				nested = nested || isInSubtree(store, &p, root)
+			}
+			if !nested {
+				own = append(own, p)
+			}
+		}
+		scopes[i].projects = own
+	}
+	return scopes
+}
+
+// candidates returns the tasks whose labels the scope may strip: the tasks of
+// its projects or, in recursive mode, every task outside the other scopes.
+func (s rootScope) candidates(store taskStore, scopes []rootScope) []*godoist.Task {
+	if !s.cfg.Recursive {
+		return GetTasks(store, s.projects)
+	}
+	if len(scopes) == 1 {
+		return store.Tasks()
+	}
+	others := map[string]bool{}
+	for _, other := range scopes {
+		if other.entry.ID == s.entry.ID {
+			continue
+		}
+		for _, p := range other.projects {
+			others[p.ID] = true
+		}
+	}
+	var out []*godoist.Task
+	for _, task := range store.Tasks() {
+		if !others[task.ProjectID] {
+			out = append(out, task)
+		}
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func rootsStore() *memoryStore {
+	return newMemoryStore(
+		[]godoist.Project{
+			{ID: "work", Name: "Work"},
+			{ID: "clients", Name: "Clients", ParentID: "work"},
+			{ID: "acme", Name: "Acme", ParentID: "clients"},
+			{ID: "home", Name: "Home"},
+			{ID: "home-clients", Name: "Clients", ParentID: "home"},
+			{ID: "inbox", Name: "Inbox"},
+		},
+		[]godoist.Task{
+			{ID: "report", Content: "Write report", ProjectID: "work"},
+			{ID: "invoice", Content: "Send invoice", ProjectID: "acme"},
+			{ID: "dishes", Content: "Dishes", ProjectID: "home"},
+			{ID: "gift", Content: "*Buy gift", ProjectID: "home-clients"},
+			{ID: "stale", Content: "Old", ProjectID: "inbox", Labels: []string{"next-work", "next-home"}},
+		},
+	)
+}
+
+func TestResolveProject(t *testing.T) {
+	store := rootsStore()
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"acme", "acme", false},
+		{"Work", "work", false},
+		{"Work/Clients", "clients", false},
+		{"Home/Clients", "home-clients", false},
+		{"Work/Clients/Acme", "acme", false},
+		{"Clients", "", true},
+		{"Work/Nope", "", true},
+		{"Nope", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveProject(store, tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveProject(%q) error = %v, want error %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.ID != tt.want {
+			t.Errorf("resolveProject(%q) = %s, want %s", tt.ref, got.ID, tt.want)
+		}
+	}
+}
+
+func TestRootConfigs(t *testing.T) {
+	cfg := defaultNextItemsConfig()
+	if got := cfg.rootConfigs(); len(got) != 1 || got[0].EntryPoint != "projects" {
+		t.Fatalf("rootConfigs() without roots = %+v", got)
+	}
+	cfg.Roots = []RootConfig{
+		{Project: "Work", ManagedLabels: []string{"next-work"}},
+		{Project: "Home", SkipPrefixes: []string{}, ColorPriority: map[string]int{"red": 4}},
+	}
+	got := cfg.rootConfigs()
+	if got[0].EntryPoint != "Work" || !reflect.DeepEqual(got[0].ManagedLabels, []string{"next-work"}) || !reflect.DeepEqual(got[0].SkipPrefixes, []string{"*"}) {
+		t.Errorf("Work root = %+v", got[0])
+	}
+	if got[1].EntryPoint != "Home" || !reflect.DeepEqual(got[1].ManagedLabels, []string{"next"}) || len(got[1].SkipPrefixes) != 0 || got[1].ColorPriority["red"] != 4 {
+		t.Errorf("Home root = %+v", got[1])
+	}
+}
+
+func TestNextItemsMultipleRoots(t *testing.T) {
+	store := rootsStore()
+	cfg := defaultNextItemsConfig()
+	cfg.Roots = []RootConfig{
+		{Project: "work", ManagedLabels: []string{"next-work"}},
+		{Project: "Work/Clients", ManagedLabels: []string{"next-clients"}},
+		{Project: "Home", ManagedLabels: []string{"next-home"}, SkipPrefixes: []string{}},
+	}
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	want := map[string][]string{
+		"report":  {"next-work"},
+		"invoice": {"next-clients"},
+		"dishes":  {"next-home"},
+		"gift":    {"next-home"},
+		"stale":   nil,
+	}
+	for id, labels := range want {
+		if got := store.Task(id).Labels; !sameLabels(got, labels) {
+			t.Errorf("%s labels = %v, want %v", id, got, labels)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/harlequix/godoist"
+)
+
+// section is a Todoist section. godoist does not model sections, so they are
+// fetched separately.
+type section struct {
+	ID           string `json:"id"`
+	ProjectID    string `json:"project_id"`
+	Name         string `json:"name"`
+	SectionOrder int    `json:"section_order"`
+}
+
+// fetchSections downloads all active sections of the account.
+func fetchSections(token string) ([]section, error) {
+	var sections []section
+	cursor := ""
+	for {
+		query := url.Values{"limit": {"200"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		req, err := http.NewRequest("GET", godoist.APIURL+"/sections?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("sections API error %s: %s", resp.Status, string(body))
+		}
+		var page struct {
+			Results    []section `json:"results"`
+			NextCursor *string   `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("decoding sections: %w", err)
+		}
+		sections = append(sections, page.Results...)
+		if page.NextCursor == nil || *page.NextCursor == "" {
+			return sections, nil
+		}
+		cursor = *page.NextCursor
+	}
+}
+
+// projectSections returns the sections of a project ordered as in Todoist.
+func projectSections(sections []*section, projectID string) []*section {
+	var out []*section
+	for _, s := range sections {
+		if s.ProjectID == projectID {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SectionOrder < out[j].SectionOrder })
+	return out
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/harlequix/godoist"
+)
+
+// sequentialOrder decides which children of a sequential parent are exposed:
+// the first limit children by ChildOrder, or only the last one.
+type sequentialOrder struct {
+	last  bool
+	limit int
+}
+
+// parseSequentialOrder parses "first", "last" or a positive number N, which
+// exposes the first N children.
+func parseSequentialOrder(s string) (sequentialOrder, error) {
+	switch s {
+	case "", "last":
+		return sequentialOrder{last: true, limit: 1}, nil
+	case "first":
+		return sequentialOrder{limit: 1}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return sequentialOrder{}, fmt.Errorf("invalid sequential order %q: want first, last or a positive number", s)
+	}
+	return sequentialOrder{limit: n}, nil
+}
+
+func (o sequentialOrder) String() string {
+	if o.last {
+		return "last"
+	}
+	if o.limit == 1 {
+		return "first"
+	}
+	return strconv.Itoa(o.limit)
+}
+
+// pick returns the items that are eligible under the order. items must be
+// sorted in Todoist order.
+func pick[T any](o sequentialOrder, items []T) []T {
+	if len(items) == 0 {
+		return items
+	}
+	if o.last {
+		return items[len(items)-1:]
+	}
+	if len(items) > o.limit {
+		return items[:o.limit]
+	}
+	return items
+}
+
+// sequentialOrderOf reports whether a parent task or section is sequential and
+// in which order. The marker may be followed by an override of defaultOrder,
+// e.g. "Checklist !first" or "Sprint !2".
+func sequentialOrderOf(name, marker, defaultOrder string) (sequentialOrder, bool) {
+	i := strings.LastIndex(name, marker)
+	if i < 0 {
+		return sequentialOrder{}, false
+	}
+	spec := name[i+len(marker):]
+	if spec == "" {
+		spec = defaultOrder
+	}
+	order, err := parseSequentialOrder(spec)
+	if err != nil {
+		return sequentialOrder{}, false
+	}
+	return order, true
+}
+
+// projectOrder reports whether a project is marked sequential in its
+// description, as "[automadoist:sequential]" (first) or with an explicit
+// order such as "[automadoist:sequential=2]".
+func projectOrder(p *godoist.Project) (sequentialOrder, bool) {
+	return metadataOrder(parseMetadata(p.Description), "sequential")
+}
+
+// subprojectOrder reports whether a project's child projects are phases, as
+// "[automadoist:sequential_subprojects]" or with an explicit order.
+func subprojectOrder(p *godoist.Project) (sequentialOrder, bool) {
+	return metadataOrder(parseMetadata(p.Description), "sequential_subprojects")
+}
+
+// sectionOrder reports whether a section is sequential, by the marker suffix
+// used for parent tasks or by a "[automadoist:sequential]" marker.
+func sectionOrder(sec *section, cfg NextItemsConfig) (sequentialOrder, bool) {
+	m := parseMetadata(sec.Name)
+	if order, ok := metadataOrder(m, "sequential"); ok {
+		return order, true
+	}
+	return sequentialOrderOf(strings.TrimSpace(m.withoutMarkers()), cfg.SequentialMarker, "first")
+}
+
+func metadataOrder(m *metadata, key string) (sequentialOrder, bool) {
+	spec, ok := m.get(key)
+	if !ok {
+		return sequentialOrder{}, false
+	}
+	if spec == "" {
+		spec = "first"
+	}
+	order, err := parseSequentialOrder(spec)
+	if err != nil {
+		return sequentialOrder{}, false
+	}
+	return order, true
+}
+
+// taskGroup is the top-level tasks of a project without a section, or of one section.
+type taskGroup struct {
+	tasks      []*godoist.Task
+	order      sequentialOrder
+	sequential bool
+}
+
+// eligibleTopLevel returns the top-level tasks traversal starts from. In a
+// sequential project only the first section (or, without sections, the first
+// task) is eligible; tasks without a section come before all sections. In a
+// sequential section, named like a sequential parent task, only its first
+// task is eligible.
+func eligibleTopLevel(store taskStore, project *godoist.Project, tasks []*godoist.Task, cfg NextItemsConfig) []*godoist.Task {
+	var roots []*godoist.Task
+	for _, task := range tasks {
+		if task.ParentID == "" {
+			roots = append(roots, task)
+		}
+	}
+	sort.SliceStable(roots, func(i, j int) bool { return roots[i].ChildOrder < roots[j].ChildOrder })
+
+	sections := store.ProjectSections(project)
+	groups := make([]taskGroup, len(sections)+1)
+	index := make(map[string]int, len(sections))
+	for i, sec := range sections {
+		index[sec.ID] = i + 1
+		groups[i+1].order, groups[i+1].sequential = sectionOrder(sec, cfg)
+	}
+	for _, task := range roots {
+		i := index[task.SectionID]
+		groups[i].tasks = append(groups[i].tasks, task)
+	}
+	var nonEmpty []taskGroup
+	for _, g := range groups {
+		if len(g.tasks) > 0 {
+			nonEmpty = append(nonEmpty, g)
+		}
+	}
+
+	if order, ok := projectOrder(project); ok {
+		if len(nonEmpty) > 1 {
+			nonEmpty = pick(order, nonEmpty)
+		} else if len(nonEmpty) == 1 && !nonEmpty[0].sequential {
+			nonEmpty[0].order, nonEmpty[0].sequential = order, true
+		}
+	}
+
+	var eligible []*godoist.Task
+	for _, g := range nonEmpty {
+		if g.sequential {
+			eligible = append(eligible, pick(g.order, g.tasks)...)
+		} else {
+			eligible = append(eligible, g.tasks...)
+		}
+	}
+	return eligible
+}
+
+// activeProjects drops the projects that belong to a later phase of a parent
+// whose subprojects are sequential. Only child projects that have tasks,
+// directly or in their own subprojects, count as phases, so an emptied phase
+// hands over to the next one.
+func activeProjects(store taskStore, projects []godoist.Project) []godoist.Project {
+	phases := map[string]map[string]bool{}
+	activePhase := func(parent, child *godoist.Project) bool {
+		active, seen := phases[parent.ID]
+		if !seen {
+			if order, ok := subprojectOrder(parent); ok {
+				active = map[string]bool{}
+				children := append([]*godoist.Project(nil), store.ChildProjects(parent)...)
+				sortByChildOrder(children)
+				var nonEmpty []*godoist.Project
+				for _, c := range children {
+					if hasTasks(store, c) {
+						nonEmpty = append(nonEmpty, c)
+					}
+				}
+				for _, c := range pick(order, nonEmpty) {
+					active[c.ID] = true
+				}
+			}
+			phases[parent.ID] = active
+		}
+		return active == nil || active[child.ID]
+	}
+
+	var out []godoist.Project
+	for _, p := range projects {
+		keep := true
+		for child := &p; child.ParentID != ""; {
+			parent := store.Project(child.ParentID)
+			if parent == nil {
+				break
+			}
+			if !activePhase(parent, child) {
+				keep = false
+				break
+			}
+			child = parent
+		}
+		if keep {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// hasTasks reports whether a project or any of its subprojects has open tasks.
+func hasTasks(store taskStore, p *godoist.Project) bool {
+	if len(store.ProjectTasks(p)) > 0 {
+		return true
+	}
+	for _, c := range store.ChildProjects(p) {
+		if hasTasks(store, c) {
+			return true
+		}
+	}
+	return false
+}
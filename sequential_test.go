@@ -0,0 +1,168 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func TestSequentialOrderOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		task   string
+		order  string
+		wantOK bool
+		want   string
+	}{
+		{"plain parent", "Launch", "last", false, ""},
+		{"marker uses configured order", "Renovate !", "last", true, "last"},
+		{"configured first", "Renovate !", "first", true, "first"},
+		{"override first", "Checklist !first", "last", true, "first"},
+		{"override last", "Checklist !last", "first", true, "last"},
+		{"wip limit", "Sprint !2", "last", true, "2"},
+		{"marker inside name", "Wow! Great", "last", false, ""},
+		{"zero limit is not sequential", "Sprint !0", "last", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sequentialOrderOf(tt.task, "!", tt.order)
+			if ok != tt.wantOK || (ok && got.String() != tt.want) {
+				t.Errorf("sequentialOrderOf(%q) = %v, %v, want %v, %v", tt.task, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+	if _, err := parseSequentialOrder("middle"); err == nil {
+		t.Error("expected error for unknown order")
+	}
+}
+
+func TestSequentialOrderExposesChildren(t *testing.T) {
+	tasks := []godoist.Task{
+		{ID: "p", Content: "Checklist !", ProjectID: "root"},
+		{ID: "c1", Content: "Step 1", ProjectID: "root", ParentID: "p", ChildOrder: 1},
+		{ID: "c2", Content: "Step 2", ProjectID: "root", ParentID: "p", ChildOrder: 2},
+		{ID: "c3", Content: "Step 3", ProjectID: "root", ParentID: "p", ChildOrder: 3},
+	}
+	tests := []struct {
+		suffix string
+		want   []string
+	}{
+		{"!", []string{"c3"}},
+		{"!first", []string{"c1"}},
+		{"!2", []string{"c1", "c2"}},
+		{"!5", []string{"c1", "c2", "c3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.suffix, func(t *testing.T) {
+			tasks[0].Content = "Checklist " + tt.suffix
+			store := newMemoryStore([]godoist.Project{{ID: "root", Name: "projects"}}, tasks)
+
+			got := getNextTasks(store, *store.Project("root"), defaultNextItemsConfig())
+
+			var ids []string
+			for _, task := range got {
+				ids = append(ids, task.ID)
+			}
+			if !sameLabels(ids, tt.want) {
+				t.Errorf("next tasks = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestSequentialContainers(t *testing.T) {
+	tasks := []godoist.Task{
+		{ID: "loose", Content: "Loose end", ProjectID: "p", ChildOrder: 1},
+		{ID: "a1", Content: "Draft", ProjectID: "p", SectionID: "s1", ChildOrder: 2},
+		{ID: "a2", Content: "Outline", ProjectID: "p", SectionID: "s1", ChildOrder: 3},
+		{ID: "b1", Content: "Print", ProjectID: "p", SectionID: "s2", ChildOrder: 4},
+	}
+	tests := []struct {
+		name        string
+		description string
+		s1          string
+		only        []string
+		want        []string
+	}{
+		{"parallel", "", "Writing", nil, []string{"loose", "a1", "a2", "b1"}},
+		{"sequential section", "", "Writing !", nil, []string{"loose", "a1", "b1"}},
+		{"sequential section override", "", "Writing !2", nil, []string{"loose", "a1", "a2", "b1"}},
+		{"sequential section marker", "", "Writing [automadoist:sequential]", nil, []string{"loose", "a1", "b1"}},
+		{"sequential project", "[automadoist:sequential]", "Writing", nil, []string{"loose"}},
+		{"sequential project skips empty groups", "[automadoist:sequential]", "Writing", []string{"a1", "a2", "b1"}, []string{"a1", "a2"}},
+		{"sequential project and section", "[automadoist:sequential]", "Writing !", []string{"a1", "a2", "b1"}, []string{"a1"}},
+		{"sequential project without sections", "[automadoist:sequential=2]", "Writing", []string{"a1", "a2"}, []string{"a1", "a2"}},
+		{"sequential project last", "[automadoist:sequential=last]", "Writing", []string{"a1", "a2"}, []string{"a2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var project []godoist.Task
+			for _, task := range tasks {
+				if tt.only == nil || slices.Contains(tt.only, task.ID) {
+					project = append(project, task)
+				}
+			}
+			store := newMemoryStore([]godoist.Project{{ID: "p", Name: "Book", Description: tt.description}}, project)
+			store.addSections(
+				section{ID: "s1", ProjectID: "p", Name: tt.s1, SectionOrder: 1},
+				section{ID: "s2", ProjectID: "p", Name: "Publishing", SectionOrder: 2},
+			)
+
+			got := getNextTasks(store, *store.Project("p"), defaultNextItemsConfig())
+
+			var ids []string
+			for _, task := range got {
+				ids = append(ids, task.ID)
+			}
+			if !sameLabels(ids, tt.want) {
+				t.Errorf("next tasks = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestSequentialSubprojects(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		want        []string
+	}{
+		{"parallel", "", []string{"kickoff", "build", "handover"}},
+		{"first phase", "[automadoist:sequential_subprojects]", []string{"kickoff"}},
+		{"two phases", "[automadoist:sequential_subprojects=2]", []string{"kickoff", "build"}},
+		{"last phase", "[automadoist:sequential_subprojects=last]", []string{"handover"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore(
+				[]godoist.Project{
+					{ID: "root", Name: "projects"},
+					{ID: "client", Name: "Client", ParentID: "root", Description: tt.description},
+					{ID: "done", Name: "Done", ParentID: "client", ChildOrder: 1},
+					{ID: "discovery", Name: "Discovery", ParentID: "client", ChildOrder: 2},
+					{ID: "workshops", Name: "Workshops", ParentID: "discovery"},
+					{ID: "delivery", Name: "Delivery", ParentID: "client", ChildOrder: 3},
+					{ID: "closing", Name: "Closing", ParentID: "client", ChildOrder: 4},
+				},
+				[]godoist.Task{
+					{ID: "kickoff", Content: "Kickoff", ProjectID: "workshops"},
+					{ID: "build", Content: "Build", ProjectID: "delivery", Labels: []string{"next"}},
+					{ID: "handover", Content: "Handover", ProjectID: "closing"},
+				},
+			)
+
+			process_next_items(store, defaultNextItemsConfig(), newChangeSet(store, false))
+
+			var got []string
+			for _, task := range store.Tasks() {
+				if hasLabel([]string{"next"}, task) {
+					got = append(got, task.ID)
+				}
+			}
+			if !sameLabels(got, tt.want) {
+				t.Errorf("next tasks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+// StaleConfig controls how next actions that have been ignored for too long
+// are flagged.
+type StaleConfig struct {
+	// Mode is "" (off), "label" or "priority".
+	Mode string `koanf:"mode"`
+	// After is how long a task may stay a next action, such as "30d".
+	After    string `koanf:"after"`
+	Label    string `koanf:"label"`
+	Priority int    `koanf:"priority"`
+}
+
+func defaultStaleConfig() StaleConfig {
+	return StaleConfig{After: "30d", Label: "stale", Priority: int(godoist.HIGH)}
+}
+
+func (c StaleConfig) verify() error {
+	switch c.Mode {
+	case "":
+		return nil
+	case "label":
+		if c.Label == "" {
+			return fmt.Errorf("label must not be empty in label mode")
+		}
+	case "priority":
+		if c.Priority < 1 || c.Priority > 4 {
+			return fmt.Errorf("priority must be between 1 and 4")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", c.Mode)
+	}
+	if d, err := parseDuration(c.After); err != nil {
+		return fmt.Errorf("after: %w", err)
+	} else if d == 0 {
+		return fmt.Errorf("after must be positive")
+	}
+	return nil
+}
+
+// Context keys for stale next actions: when the task became a next action,
+// when it was flagged as stale and the priority it had before.
+const (
+	nextSinceKey     = "next_since"
+	staleAtKey       = "stale_at"
+	stalePriorityKey = "stale_priority"
+)
+
+// labels returns the label automadoist adds to stale tasks, if any.
+func (c StaleConfig) labels() []string {
+	if c.Mode == "label" {
+		return []string{c.Label}
+	}
+	return nil
+}
+
+// flagStale records when next actions were first seen and flags those that
+// have been next actions for longer than cfg.Stale.After, once, by labeling
+// them or raising their priority. Both are undone when the task stops being
+// a next action.
+func flagStale(cfg NextItemsConfig, cs *changeSet, nextTasks []*godoist.Task, now time.Time) {
+	sc := cfg.Stale
+	if sc.Mode == "" {
+		return
+	}
+	after, err := parseDuration(sc.After)
+	if err != nil || after == 0 {
+		logger.Warn("Ignoring invalid stale.after", "after", sc.After)
+		return
+	}
+	runParallel(nextTasks, func(t *godoist.Task) {
+		ctx, err := cs.context(t)
+		if err != nil {
+			logger.Error("Failed to read context", "task", t.Content, "error", err)
+			return
+		}
+		since, ok := contextTime(ctx, nextSinceKey)
+		if !ok {
+			if err := cs.updateContext(t, map[string]interface{}{nextSinceKey: now.Format(time.RFC3339)}, "next action"); err != nil {
+				logger.Error("Failed to update context", "task", t.Content, "error", err)
+			}
+			return
+		}
+		if _, flagged := ctx[staleAtKey]; flagged || now.Before(since.Add(after)) {
+			return
+		}
+		logger.Info("Stale next action", "task", t.Content, "since", since)
+		reason := "next action since " + since.Format(deferLayout)
+		updates := map[string]interface{}{staleAtKey: now.Format(time.RFC3339)}
+		switch sc.Mode {
+		case "label":
+			err = cs.addLabel(t, sc.Label, reason)
+		case "priority":
+			if t.Priority < godoist.PRIORITY_LEVEL(sc.Priority) {
+				updates[stalePriorityKey] = int(t.Priority)
+				err = cs.setPriority(t, godoist.PRIORITY_LEVEL(sc.Priority), reason)
+			}
+		}
+		if err != nil {
+			logger.Error("Failed to flag stale task", "task", t.Content, "error", err)
+			return
+		}
+		if err := cs.updateContext(t, updates, reason); err != nil {
+			logger.Error("Failed to update context", "task", t.Content, "error", err)
+		}
+	})
+}
+
+// unflagStale restores the priority a stale task had before it was raised,
+// unless it was changed by hand since.
+func unflagStale(cfg NextItemsConfig, cs *changeSet, t *godoist.Task, ctx map[string]interface{}) {
+	raw, ok := ctx[stalePriorityKey]
+	if !ok || t.Priority != godoist.PRIORITY_LEVEL(cfg.Stale.Priority) {
+		return
+	}
+	if err := cs.setPriority(t, priorityValue(raw), "no longer a next action"); err != nil {
+		logger.Error("Failed to update priority", "task", t.Content, "error", err)
+	}
+}
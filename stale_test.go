@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+func staleStore() *memoryStore {
+	store := newMemoryStore(
+		[]godoist.Project{{ID: "root", Name: "projects"}},
+		[]godoist.Task{
+			{ID: "fresh", Content: "Book flights", ProjectID: "root", Priority: godoist.VERY_LOW},
+			{ID: "ignored", Content: "Clean garage", ProjectID: "root", Labels: []string{"next"}, Priority: godoist.LOW},
+		},
+	)
+	long := time.Now().Add(-40 * 24 * time.Hour).Format(time.RFC3339)
+	store.SetContext(store.Task("ignored"), map[string]interface{}{addedLabelsKey: []string{"next"}, nextSinceKey: long})
+	return store
+}
+
+func TestStaleNextActions(t *testing.T) {
+	t.Run("label", func(t *testing.T) {
+		store := staleStore()
+		cfg := defaultNextItemsConfig()
+		cfg.Stale.Mode = "label"
+
+		process_next_items(store, cfg, newChangeSet(store, false))
+
+		ctx, _ := store.GetContext(store.Task("fresh"))
+		if _, ok := contextTime(ctx, nextSinceKey); !ok {
+			t.Errorf("fresh context = %v, want next_since", ctx)
+		}
+		if hasLabel([]string{"stale"}, store.Task("fresh")) {
+			t.Errorf("fresh labels = %v, want not stale", store.Task("fresh").Labels)
+		}
+		if !hasLabel([]string{"stale"}, store.Task("ignored")) {
+			t.Errorf("ignored labels = %v, want stale", store.Task("ignored").Labels)
+		}
+
+		// A stale label removed by hand is not added again.
+		cs := newChangeSet(store, false)
+		cs.removeLabel(store.Task("ignored"), "stale", "test")
+		process_next_items(store, cfg, cs)
+		if hasLabel([]string{"stale"}, store.Task("ignored")) {
+			t.Errorf("ignored labels = %v, stale label came back", store.Task("ignored").Labels)
+		}
+
+		// Leaving next strips the label and clears the record.
+		cs = newChangeSet(store, false)
+		cs.addLabel(store.Task("fresh"), "stale", "test")
+		cs.addLabel(store.Task("fresh"), "waiting", "test")
+		process_next_items(store, cfg, cs)
+		if got := store.Task("fresh").Labels; !sameLabels(got, []string{"waiting"}) || len(got) != 1 {
+			t.Errorf("fresh labels = %v, want [waiting]", got)
+		}
+		if ctx, _ := store.GetContext(store.Task("fresh")); len(ctx) != 0 {
+			t.Errorf("fresh context = %v, want cleared", ctx)
+		}
+	})
+
+	t.Run("priority", func(t *testing.T) {
+		store := staleStore()
+		cfg := defaultNextItemsConfig()
+		cfg.Stale.Mode = "priority"
+
+		process_next_items(store, cfg, newChangeSet(store, false))
+		if got := store.Task("ignored").Priority; got != godoist.HIGH {
+			t.Fatalf("ignored priority = %v, want high", got)
+		}
+		if got := store.Task("fresh").Priority; got != godoist.VERY_LOW {
+			t.Errorf("fresh priority = %v, want unchanged", got)
+		}
+
+		// Once it is no longer a next action, the old priority comes back.
+		cs := newChangeSet(store, false)
+		cs.addLabel(store.Task("ignored"), "waiting", "test")
+		process_next_items(store, cfg, cs)
+		if got := store.Task("ignored").Priority; got != godoist.LOW {
+			t.Errorf("ignored priority = %v, want low again", got)
+		}
+		ctx, _ := store.GetContext(store.Task("ignored"))
+		for _, key := range []string{nextSinceKey, staleAtKey, stalePriorityKey} {
+			if _, ok := ctx[key]; ok {
+				t.Errorf("ignored context = %v, want %s cleared", ctx, key)
+			}
+		}
+	})
+}
+
+func TestStaleConfigVerify(t *testing.T) {
+	tests := []struct {
+		cfg     StaleConfig
+		wantErr bool
+	}{
+		{StaleConfig{}, false},
+		{StaleConfig{Mode: "label", After: "30d", Label: "stale"}, false},
+		{StaleConfig{Mode: "priority", After: "2w", Priority: 4}, false},
+		{StaleConfig{Mode: "label", After: "30d"}, true},
+		{StaleConfig{Mode: "priority", After: "30d", Priority: 0}, true},
+		{StaleConfig{Mode: "label", After: "0d", Label: "stale"}, true},
+		{StaleConfig{Mode: "email", After: "30d"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.verify(); (err != nil) != tt.wantErr {
+			t.Errorf("verify(%+v) = %v, want error %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
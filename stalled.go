@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+// StalledConfig controls how projects and parallel parent tasks without a
+// next action are flagged.
+type StalledConfig struct {
+	// Mode is "" (off), "report", "label" or "create".
+	Mode    string `koanf:"mode"`
+	Label   string `koanf:"label"`
+	Content string `koanf:"content"`
+}
+
+func defaultStalledConfig() StalledConfig {
+	return StalledConfig{Label: "stalled", Content: "Define next action"}
+}
+
+func (c StalledConfig) verify() error {
+	switch c.Mode {
+	case "", "report":
+	case "label":
+		if c.Label == "" {
+			return fmt.Errorf("label must not be empty in label mode")
+		}
+	case "create":
+		if c.Content == "" {
+			return fmt.Errorf("content must not be empty in create mode")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", c.Mode)
+	}
+	return nil
+}
+
+// stalledItem is a project, or a parent task within it, without a next action.
+type stalledItem struct {
+	project *godoist.Project
+	parent  *godoist.Task
+}
+
+func (s stalledItem) String() string {
+	if s.parent != nil {
+		return fmt.Sprintf("task %q in %q", s.parent.Content, s.project.Name)
+	}
+	return fmt.Sprintf("project %q", s.project.Name)
+}
+
+// waitingFor reports whether a task is held back for a reason the user chose:
+// an ignore label such as @waiting, a defer date or a blocker. A project with
+// such a task is not stalled.
+func waitingFor(store taskStore, task *godoist.Task, cfg NextItemsConfig, now time.Time) bool {
+	return hasLabel(cfg.IgnoreLabels, task) || taskDeferred(task, cfg, now) || taskBlocked(store, task)
+}
+
+// findStalled returns the projects and parallel parent tasks that yield no
+// next action. A project counts as stalled when neither it nor its
+// subprojects have a next action or a waiting task; a container project
+// without tasks of its own is left to its subprojects. Deferred projects are
+// never stalled.
+func findStalled(store taskStore, cfg NextItemsConfig, projects []godoist.Project, traversals map[string]projectTraversal) []stalledItem {
+	now := time.Now()
+	inScope := make(map[string]bool, len(projects))
+	for _, p := range projects {
+		inScope[p.ID] = true
+	}
+	next := map[string]bool{}
+	for _, t := range traversals {
+		for _, task := range t.next {
+			next[task.ID] = true
+		}
+	}
+
+	activity := map[string]bool{}
+	for _, p := range projects {
+		if traversals[p.ID].deferred || len(traversals[p.ID].next) > 0 {
+			activity[p.ID] = true
+			continue
+		}
+		for _, task := range store.ProjectTasks(&p) {
+			if waitingFor(store, task, cfg, now) {
+				activity[p.ID] = true
+				break
+			}
+		}
+	}
+	var subtreeActive func(p *godoist.Project) bool
+	subtreeActive = func(p *godoist.Project) bool {
+		if activity[p.ID] {
+			return true
+		}
+		for _, c := range store.ChildProjects(p) {
+			if inScope[c.ID] && subtreeActive(c) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var stalled []stalledItem
+	for i := range projects {
+		p := &projects[i]
+		if traversals[p.ID].deferred {
+			continue
+		}
+		if !subtreeActive(p) {
+			hasChildren := false
+			for _, c := range store.ChildProjects(p) {
+				hasChildren = hasChildren || inScope[c.ID]
+			}
+			if len(store.ProjectTasks(p)) > 0 || !hasChildren {
+				stalled = append(stalled, stalledItem{project: p})
+			}
+			continue
+		}
+		for _, parent := range traversals[p.ID].parents {
+			if !subtaskActive(store, parent, cfg, next, now) {
+				stalled = append(stalled, stalledItem{project: p, parent: parent})
+			}
+		}
+	}
+	return stalled
+}
+
+// subtaskActive reports whether any task below parent is a next action or
+// waiting.
+func subtaskActive(store taskStore, parent *godoist.Task, cfg NextItemsConfig, next map[string]bool, now time.Time) bool {
+	for _, c := range store.ChildTasks(parent) {
+		if next[c.ID] || waitingFor(store, c, cfg, now) || subtaskActive(store, c, cfg, next, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagStalled reports, labels or creates a next action for every stalled
+// project and parent task. In label mode the label is removed from
+// candidates that are no longer stalled.
+func flagStalled(store taskStore, cfg NextItemsConfig, cs *changeSet, projects []godoist.Project, traversals map[string]projectTraversal, candidates []*godoist.Task) {
+	if cfg.Stalled.Mode == "" {
+		return
+	}
+	stalled := findStalled(store, cfg, projects, traversals)
+	flagged := map[string]bool{}
+	for _, item := range stalled {
+		logger.Warn("Stalled: no next action", "item", item.String())
+		switch cfg.Stalled.Mode {
+		case "label":
+			placeholder := item.parent
+			if placeholder == nil {
+				placeholder = firstTopLevelTask(store, item.project)
+			}
+			if placeholder == nil {
+				continue
+			}
+			flagged[placeholder.ID] = true
+			if err := cs.addLabel(placeholder, cfg.Stalled.Label, "stalled "+item.String()); err != nil {
+				logger.Error("Failed to add label", "label", cfg.Stalled.Label, "task", placeholder.Content, "error", err)
+			}
+		case "create":
+			if hasPlaceholder(store, item, cfg.Stalled.Content) {
+				continue
+			}
+			t := godoist.Task{Content: cfg.Stalled.Content, ProjectID: item.project.ID}
+			if item.parent != nil {
+				t.ParentID = item.parent.ID
+			}
+			if _, err := cs.createTask(t, "stalled "+item.String()); err != nil {
+				logger.Error("Failed to create task", "content", t.Content, "error", err)
+			}
+		}
+	}
+	if cfg.Stalled.Mode != "label" || !cfg.Prune {
+		return
+	}
+	for _, task := range candidates {
+		if hasLabel([]string{cfg.Stalled.Label}, task) && !flagged[task.ID] {
+			if err := cs.removeLabel(task, cfg.Stalled.Label, "no longer stalled"); err != nil {
+				logger.Error("Failed to remove label", "label", cfg.Stalled.Label, "task", task.Content, "error", err)
+			}
+		}
+	}
+}
+
+// hasPlaceholder reports whether a stalled item already has an open task with
+// the given content, at the top of its project or below its parent task. Such
+// a task is not necessarily a next action, e.g. behind a skipped task in a
+// sequential project, so the item can stay stalled across runs.
+func hasPlaceholder(store taskStore, item stalledItem, content string) bool {
+	if item.parent != nil {
+		return hasFollowUp(store, item.parent, content)
+	}
+	for _, t := range store.ProjectTasks(item.project) {
+		if t.ParentID == "" && t.Content == content && !t.Checked {
+			return true
+		}
+	}
+	return false
+}
+
+// firstTopLevelTask returns the project's first task in Todoist order.
+func firstTopLevelTask(store taskStore, p *godoist.Project) *godoist.Task {
+	var top []*godoist.Task
+	for _, task := range store.ProjectTasks(p) {
+		if task.ParentID == "" {
+			top = append(top, task)
+		}
+	}
+	if len(top) == 0 {
+		return nil
+	}
+	sort.SliceStable(top, func(i, j int) bool { return top[i].ChildOrder < top[j].ChildOrder })
+	return top[0]
+}
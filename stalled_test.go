@@ -0,0 +1,154 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func stalledStore() *memoryStore {
+	return newMemoryStore(
+		[]godoist.Project{
+			{ID: "root", Name: "projects"},
+			{ID: "active", Name: "Active", ParentID: "root"},
+			{ID: "empty", Name: "Empty", ParentID: "root"},
+			{ID: "waiting", Name: "Waiting", ParentID: "root"},
+			{ID: "someday", Name: "Someday", ParentID: "root"},
+			{ID: "later", Name: "Later", ParentID: "root", Description: "[automadoist:defer=2999-01-01]"},
+			{ID: "area", Name: "Area", ParentID: "root"},
+			{ID: "sub", Name: "Sub", ParentID: "area"},
+		},
+		[]godoist.Task{
+			{ID: "a1", Content: "Do it", ProjectID: "active", ChildOrder: 1},
+			{ID: "plan", Content: "Plan", ProjectID: "active", ChildOrder: 2},
+			{ID: "idea", Content: "*Idea", ProjectID: "active", ParentID: "plan"},
+			{ID: "w1", Content: "Call back", ProjectID: "waiting", Labels: []string{"waiting"}},
+			{ID: "s1", Content: "*Maybe", ProjectID: "someday"},
+			{ID: "l1", Content: "Later", ProjectID: "later"},
+			{ID: "sub1", Content: "*Think", ProjectID: "sub"},
+		},
+	)
+}
+
+func TestFindStalled(t *testing.T) {
+	store := stalledStore()
+	cfg := defaultNextItemsConfig()
+	projects := collectProjects(store, *store.Project("root"))
+	traversals := map[string]projectTraversal{}
+	for _, p := range projects {
+		traversals[p.ID] = traverseProject(store, p, cfg)
+	}
+
+	var got []string
+	for _, item := range findStalled(store, cfg, projects, traversals) {
+		got = append(got, item.String())
+	}
+	sort.Strings(got)
+	want := []string{`project "Empty"`, `project "Someday"`, `project "Sub"`, `task "Plan" in "Active"`}
+	if !sameLabels(got, want) || len(got) != len(want) {
+		t.Errorf("findStalled() = %q, want %q", got, want)
+	}
+}
+
+func TestStalledLabelMode(t *testing.T) {
+	store := stalledStore()
+	store.Task("a1").Labels = []string{"stalled"}
+	cfg := defaultNextItemsConfig()
+	cfg.Stalled.Mode = "label"
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	for _, id := range []string{"plan", "s1", "sub1"} {
+		if !hasLabel([]string{"stalled"}, store.Task(id)) {
+			t.Errorf("%s labels = %v, want stalled", id, store.Task(id).Labels)
+		}
+	}
+	if hasLabel([]string{"stalled"}, store.Task("a1")) {
+		t.Errorf("a1 labels = %v, want stalled removed", store.Task("a1").Labels)
+	}
+}
+
+func TestStalledCreateMode(t *testing.T) {
+	store := stalledStore()
+	cfg := defaultNextItemsConfig()
+	cfg.Stalled.Mode = "create"
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	created := map[string]string{}
+	for _, task := range store.Tasks() {
+		if task.Content == "Define next action" {
+			created[task.ProjectID+"/"+task.ParentID] = task.ID
+		}
+	}
+	for _, where := range []string{"empty/", "someday/", "sub/", "active/plan"} {
+		if created[where] == "" {
+			t.Errorf("no next action created in %s; created %v", where, created)
+		}
+	}
+	if len(created) != 4 {
+		t.Errorf("created %d tasks, want 4", len(created))
+	}
+
+	// The created tasks are next actions now, so nothing is stalled any more.
+	cs := newChangeSet(store, false)
+	process_next_items(store, cfg, cs)
+	for _, c := range cs.Changes() {
+		if c.Field == "created" {
+			t.Errorf("second run created %q in %v", c.Content, c.New)
+		}
+	}
+}
+
+func TestStalledCreateModeRunsTwice(t *testing.T) {
+	// The created task goes last, behind the skipped tasks of a sequential
+	// project, so the project stays stalled on the next run.
+	store := newMemoryStore(
+		[]godoist.Project{
+			{ID: "root", Name: "projects"},
+			{ID: "trip", Name: "Trip", ParentID: "root", Description: "[automadoist:sequential]"},
+		},
+		[]godoist.Task{
+			{ID: "think", Content: "*Think", ProjectID: "trip", ChildOrder: 1},
+			{ID: "book", Content: "Book hotel", ProjectID: "trip", ChildOrder: 2},
+		},
+	)
+	cfg := defaultNextItemsConfig()
+	cfg.Stalled.Mode = "create"
+
+	for run := 1; run <= 2; run++ {
+		process_next_items(store, cfg, newChangeSet(store, false))
+		var created []*godoist.Task
+		for _, task := range store.Tasks() {
+			if task.Content == "Define next action" {
+				created = append(created, task)
+			}
+		}
+		if len(created) != 1 {
+			t.Fatalf("after run %d: %d placeholder tasks, want 1", run, len(created))
+		}
+		if created[0].ChildOrder != 3 {
+			t.Errorf("placeholder order = %d, want 3", created[0].ChildOrder)
+		}
+	}
+}
+
+func TestStalledConfigVerify(t *testing.T) {
+	tests := []struct {
+		cfg     StalledConfig
+		wantErr bool
+	}{
+		{StalledConfig{}, false},
+		{StalledConfig{Mode: "report"}, false},
+		{StalledConfig{Mode: "label", Label: "stalled"}, false},
+		{StalledConfig{Mode: "label"}, true},
+		{StalledConfig{Mode: "create"}, true},
+		{StalledConfig{Mode: "email"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.verify(); (err != nil) != tt.wantErr {
+			t.Errorf("verify(%+v) = %v, want error %v", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
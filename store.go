@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/harlequix/godoist"
+)
+
+// taskStore is the subset of Todoist operations the commands rely on. It lets
+// the traversal and labeling logic run against the live API or an in-memory
+// copy of an account.
+type taskStore interface {
+	Sync() error
+	Commit() error
+
+	Projects() []*godoist.Project
+	Project(id string) *godoist.Project
+	ProjectsByName(name string) []*godoist.Project
+	ChildProjects(p *godoist.Project) []*godoist.Project
+	ProjectSections(p *godoist.Project) []*section
+
+	Tasks() []*godoist.Task
+	Task(id string) *godoist.Task
+	ProjectTasks(p *godoist.Project) []*godoist.Task
+	ChildTasks(t *godoist.Task) []*godoist.Task
+
+	AddTask(t godoist.Task) (*godoist.Task, error)
+	CloseTask(t *godoist.Task) error
+	ReopenTask(id string) error
+	// TaskCompleted reports whether a task that is no longer synced was
+	// completed, as opposed to deleted.
+	TaskCompleted(id string) (bool, error)
+	UpdateTask(t *godoist.Task, field string, value interface{}) error
+	UpdateProject(p *godoist.Project, field string, value interface{}) error
+
+	GetContext(t *godoist.Task) (map[string]interface{}, error)
+	SetContext(t *godoist.Task, ctx map[string]interface{}) error
+	DeleteContext(t *godoist.Task) error
+}
+
+// todoistStore is a taskStore backed by the Todoist API.
+type todoistStore struct {
+	client   *godoist.Todoist
+	sections []*section
+	token    string
+	// cache is the path of the sync snapshot. If empty, every Sync downloads
+	// the whole account.
+	cache    string
+	fullSync bool
+
+	// contexts holds the context comment of each task, keyed by task ID, as
+	// of the last cached sync.
+	mu       sync.Mutex
+	contexts map[string]syncNote
+}
+
+func newTodoistStore(token string) *todoistStore {
+	return &todoistStore{client: godoist.NewTodoist(token), token: token}
+}
+
+// newCachedTodoistStore returns a store that syncs incrementally against the
+// snapshot at cache. With fullSync set the first Sync ignores the snapshot.
+func newCachedTodoistStore(token, cache string, fullSync bool) *todoistStore {
+	s := newTodoistStore(token)
+	s.cache = cache
+	s.fullSync = fullSync
+	return s
+}
+
+func (s *todoistStore) Sync() error {
+	if s.cache == "" {
+		if err := s.client.Sync(); err != nil {
+			return err
+		}
+		sections, err := fetchSections(s.token)
+		if err != nil {
+			return err
+		}
+		s.setSections(sections)
+		return nil
+	}
+	snap, err := incrementalSync(s.token, s.cache, s.fullSync)
+	if err != nil {
+		return err
+	}
+	s.fullSync = false
+	s.client = godoist.NewTodoist(s.token)
+	s.client.Tasks.Update(snap.Tasks)
+	s.client.Projects.Update(snap.Projects)
+	s.setSections(snap.Sections)
+	s.mu.Lock()
+	s.contexts = make(map[string]syncNote, len(snap.Notes))
+	for _, n := range snap.Notes {
+		s.contexts[n.taskID()] = n
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *todoistStore) setSections(sections []section) {
+	s.sections = make([]*section, len(sections))
+	for i := range sections {
+		s.sections[i] = &sections[i]
+	}
+}
+
+func (s *todoistStore) Commit() error { return s.client.Commit() }
+
+func (s *todoistStore) Projects() []*godoist.Project       { return s.client.Projects.All() }
+func (s *todoistStore) Project(id string) *godoist.Project { return s.client.Projects.Get(id) }
+func (s *todoistStore) ProjectsByName(name string) []*godoist.Project {
+	return s.client.Projects.GetByName(name)
+}
+func (s *todoistStore) ChildProjects(p *godoist.Project) []*godoist.Project { return p.GetChildren() }
+func (s *todoistStore) ProjectSections(p *godoist.Project) []*section {
+	return projectSections(s.sections, p.ID)
+}
+
+func (s *todoistStore) Tasks() []*godoist.Task                          { return s.client.Tasks.All() }
+func (s *todoistStore) Task(id string) *godoist.Task                    { return s.client.Tasks.Get(id) }
+func (s *todoistStore) ProjectTasks(p *godoist.Project) []*godoist.Task { return p.GetTasks() }
+func (s *todoistStore) ChildTasks(t *godoist.Task) []*godoist.Task      { return t.GetChildren() }
+
+// AddTask creates a task with the content, project, parent and labels of t.
+func (s *todoistStore) AddTask(t godoist.Task) (*godoist.Task, error) {
+	fields := map[string]interface{}{"content": t.Content, "project_id": t.ProjectID}
+	if t.ParentID != "" {
+		fields["parent_id"] = t.ParentID
+	}
+	if len(t.Labels) > 0 {
+		fields["labels"] = t.Labels
+	}
+	created, err := s.client.API.CreateTask(fields)
+	if err != nil {
+		return nil, err
+	}
+	s.client.Tasks.Update([]godoist.Task{*created})
+	return s.client.Tasks.Get(created.ID), nil
+}
+
+func (s *todoistStore) CloseTask(t *godoist.Task) error { return t.Close() }
+
+// ReopenTask uncompletes a task. Completed tasks are not synced, so it is
+// looked up by ID only; it shows up again with the next sync.
+func (s *todoistStore) ReopenTask(id string) error { return s.client.API.ReopenTask(id) }
+
+func (s *todoistStore) TaskCompleted(id string) (bool, error) {
+	req, err := http.NewRequest("GET", godoist.APIURL+"/tasks/"+url.PathEscape(id), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("tasks API error %s: %s", resp.Status, string(body))
+	}
+	var task struct {
+		Checked   bool `json:"checked"`
+		IsDeleted bool `json:"is_deleted"`
+	}
+	if err := json.Unmarshal(body, &task); err != nil {
+		return false, fmt.Errorf("decoding task: %w", err)
+	}
+	return task.Checked && !task.IsDeleted, nil
+}
+
+func (s *todoistStore) UpdateTask(t *godoist.Task, field string, value interface{}) error {
+	return t.Update(field, value)
+}
+
+func (s *todoistStore) UpdateProject(p *godoist.Project, field string, value interface{}) error {
+	return p.Update(field, value)
+}
+
+// cachedContext returns the task's context comment from the last sync. ok is
+// false when the store does not cache context comments.
+func (s *todoistStore) cachedContext(id string) (note syncNote, found, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.contexts == nil {
+		return syncNote{}, false, false
+	}
+	note, found = s.contexts[id]
+	return note, found, true
+}
+
+func (s *todoistStore) GetContext(t *godoist.Task) (map[string]interface{}, error) {
+	note, found, ok := s.cachedContext(t.ID)
+	if !ok {
+		return t.GetContext()
+	}
+	ctx := make(map[string]interface{})
+	if !found {
+		return ctx, nil
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(note.Content, godoist.ContextPrefix+" ")), &ctx); err != nil {
+		return nil, fmt.Errorf("failed to parse context: %w", err)
+	}
+	return ctx, nil
+}
+
+func (s *todoistStore) SetContext(t *godoist.Task, ctx map[string]interface{}) error {
+	note, found, ok := s.cachedContext(t.ID)
+	if !ok {
+		return t.SetContext(ctx)
+	}
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal context: %w", err)
+	}
+	content := godoist.ContextPrefix + " " + string(data)
+	if found {
+		if err := s.client.API.UpdateComment(note.ID, content); err != nil {
+			return err
+		}
+	} else {
+		created, err := s.client.API.CreateComment(t.ID, content)
+		if err != nil {
+			return err
+		}
+		note = syncNote{ID: created.ID, TaskID: t.ID}
+	}
+	note.Content = content
+	s.mu.Lock()
+	s.contexts[t.ID] = note
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *todoistStore) DeleteContext(t *godoist.Task) error {
+	note, found, ok := s.cachedContext(t.ID)
+	if !ok {
+		return t.DeleteContext()
+	}
+	if !found {
+		return nil
+	}
+	if err := s.client.API.DeleteComment(note.ID); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.contexts, t.ID)
+	s.mu.Unlock()
+	return nil
+}
+
+// memoryStore is a taskStore that keeps an account in memory. Sync and Commit
+// are no-ops; updates are applied to the stored tasks and projects directly.
+type memoryStore struct {
+	mu       sync.Mutex
+	projects map[string]*godoist.Project
+	sections []*section
+	tasks    map[string]*godoist.Task
+	closed   map[string]*godoist.Task
+	contexts map[string]map[string]interface{}
+}
+
+func newMemoryStore(projects []godoist.Project, tasks []godoist.Task) *memoryStore {
+	s := &memoryStore{
+		projects: make(map[string]*godoist.Project, len(projects)),
+		tasks:    make(map[string]*godoist.Task, len(tasks)),
+		closed:   make(map[string]*godoist.Task),
+		contexts: make(map[string]map[string]interface{}),
+	}
+	for i := range projects {
+		p := projects[i]
+		s.projects[p.ID] = &p
+	}
+	for i := range tasks {
+		t := tasks[i]
+		s.tasks[t.ID] = &t
+	}
+	return s
+}
+
+// addSections adds sections to the stored account.
+func (s *memoryStore) addSections(sections ...section) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range sections {
+		s.sections = append(s.sections, &sections[i])
+	}
+}
+
+func (s *memoryStore) ProjectSections(p *godoist.Project) []*section {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return projectSections(s.sections, p.ID)
+}
+
+func (s *memoryStore) Sync() error   { return nil }
+func (s *memoryStore) Commit() error { return nil }
+
+func (s *memoryStore) Projects() []*godoist.Project {
+	return s.filterProjects(func(*godoist.Project) bool { return true })
+}
+
+func (s *memoryStore) Project(id string) *godoist.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.projects[id]
+}
+
+func (s *memoryStore) ProjectsByName(name string) []*godoist.Project {
+	return s.filterProjects(func(p *godoist.Project) bool { return p.Name == name })
+}
+
+func (s *memoryStore) ChildProjects(p *godoist.Project) []*godoist.Project {
+	return s.filterProjects(func(c *godoist.Project) bool { return c.ParentID == p.ID })
+}
+
+func (s *memoryStore) Tasks() []*godoist.Task {
+	return s.filterTasks(func(*godoist.Task) bool { return true })
+}
+
+func (s *memoryStore) Task(id string) *godoist.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tasks[id]
+}
+
+func (s *memoryStore) ProjectTasks(p *godoist.Project) []*godoist.Task {
+	return s.filterTasks(func(t *godoist.Task) bool { return t.ProjectID == p.ID })
+}
+
+func (s *memoryStore) ChildTasks(t *godoist.Task) []*godoist.Task {
+	return s.filterTasks(func(c *godoist.Task) bool { return c.ParentID == t.ID })
+}
+
+// filterProjects returns matching projects sorted by ID so results are deterministic.
+func (s *memoryStore) filterProjects(match func(*godoist.Project) bool) []*godoist.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []*godoist.Project{}
+	for _, p := range s.projects {
+		if match(p) {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// filterTasks returns matching tasks sorted by ID so results are deterministic.
+func (s *memoryStore) filterTasks(match func(*godoist.Task) bool) []*godoist.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []*godoist.Task{}
+	for _, t := range s.tasks {
+		if match(t) {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// AddTask stores a new task. Like Todoist, it goes after its siblings unless
+// t sets an order.
+func (s *memoryStore) AddTask(t godoist.Task) (*godoist.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.ID = fmt.Sprintf("new%d", len(s.tasks)+1)
+	for s.tasks[t.ID] != nil {
+		t.ID += "'"
+	}
+	if t.ChildOrder == 0 {
+		for _, sibling := range s.tasks {
+			if sibling.ProjectID == t.ProjectID && sibling.ParentID == t.ParentID && sibling.ChildOrder >= t.ChildOrder {
+				t.ChildOrder = sibling.ChildOrder + 1
+			}
+		}
+	}
+	s.tasks[t.ID] = &t
+	return &t, nil
+}
+
+// CloseTask drops the task, as a sync would after completing it.
+func (s *memoryStore) CloseTask(t *godoist.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, t.ID)
+	s.closed[t.ID] = t
+	return nil
+}
+
+// ReopenTask brings back a task closed through CloseTask.
+func (s *memoryStore) ReopenTask(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.closed[id]
+	if !ok {
+		return fmt.Errorf("task %s is not closed", id)
+	}
+	delete(s.closed, id)
+	s.tasks[id] = t
+	return nil
+}
+
+// TaskCompleted reports whether the task was closed through CloseTask.
+func (s *memoryStore) TaskCompleted(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.closed[id]
+	return ok, nil
+}
+
+func (s *memoryStore) UpdateTask(t *godoist.Task, field string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch field {
+	case "content":
+		t.Content = value.(string)
+	case "description":
+		t.Description = value.(string)
+	case "labels":
+		t.Labels = value.([]string)
+	case "priority":
+		t.Priority = value.(godoist.PRIORITY_LEVEL)
+	default:
+		return errors.New("unknown/unsupported Update")
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdateProject(p *godoist.Project, field string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch field {
+	case "name":
+		p.Name = value.(string)
+	case "description":
+		p.Description = value.(string)
+	case "color":
+		p.Color = value.(string)
+	default:
+		return errors.New("unknown/unsupported Update")
+	}
+	return nil
+}
+
+func (s *memoryStore) GetContext(t *godoist.Task) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx := make(map[string]interface{})
+	for k, v := range s.contexts[t.ID] {
+		ctx[k] = v
+	}
+	return ctx, nil
+}
+
+func (s *memoryStore) SetContext(t *godoist.Task, ctx map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := make(map[string]interface{}, len(ctx))
+	for k, v := range ctx {
+		stored[k] = v
+	}
+	s.contexts[t.ID] = stored
+	return nil
+}
+
+func (s *memoryStore) DeleteContext(t *godoist.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.contexts, t.ID)
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/harlequix/godoist"
+)
+
+func testStore() *memoryStore {
+	return newMemoryStore(
+		[]godoist.Project{
+			{ID: "root", Name: "projects"},
+			{ID: "p1", Name: "Home", ParentID: "root", Color: "red", Description: "[automadoist:tags=home]"},
+			{ID: "other", Name: "Elsewhere"},
+		},
+		[]godoist.Task{
+			{ID: "t1", Content: "Buy milk", ProjectID: "p1", Priority: godoist.VERY_LOW},
+			{ID: "t2", Content: "*Review finances", ProjectID: "p1"},
+			{ID: "t3", Content: "Wait for plumber", ProjectID: "p1", Labels: []string{"waiting"}},
+			{ID: "t4", Content: "Renovate !", ProjectID: "p1"},
+			{ID: "t5", Content: "Pick paint", ProjectID: "p1", ParentID: "t4", ChildOrder: 1},
+			{ID: "t6", Content: "Paint walls", ProjectID: "p1", ParentID: "t4", ChildOrder: 2},
+			{ID: "t7", Content: "Stale", ProjectID: "other", Labels: []string{"next", "errand", "waiting"}, Priority: godoist.HIGH},
+		},
+	)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := testStore()
+
+	if got := store.ProjectsByName("Home"); len(got) != 1 || got[0].ID != "p1" {
+		t.Errorf("ProjectsByName(Home) = %v", got)
+	}
+	if got := store.ChildProjects(store.Project("root")); len(got) != 1 || got[0].ID != "p1" {
+		t.Errorf("ChildProjects(root) = %v", got)
+	}
+	if got := store.ChildTasks(store.Task("t4")); len(got) != 2 {
+		t.Errorf("ChildTasks(t4) = %v, want 2 tasks", got)
+	}
+	if got := store.ProjectTasks(store.Project("other")); len(got) != 1 || got[0].ID != "t7" {
+		t.Errorf("ProjectTasks(other) = %v", got)
+	}
+
+	task := store.Task("t1")
+	if err := store.UpdateTask(task, "labels", []string{"x"}); err != nil || !reflect.DeepEqual(task.Labels, []string{"x"}) {
+		t.Errorf("UpdateTask(labels) = %v, labels %v", err, task.Labels)
+	}
+	if err := store.UpdateTask(task, "bogus", 1); err == nil {
+		t.Error("expected error for unsupported field")
+	}
+
+	store.SetContext(task, map[string]interface{}{"priority": 3})
+	ctx, _ := store.GetContext(task)
+	if ctx["priority"] != 3 {
+		t.Errorf("GetContext() = %v", ctx)
+	}
+	store.DeleteContext(task)
+	if ctx, _ := store.GetContext(task); len(ctx) != 0 {
+		t.Errorf("GetContext() after delete = %v, want empty", ctx)
+	}
+}
+
+func TestProcessNextItemsWithMemoryStore(t *testing.T) {
+	store := testStore()
+	cfg := defaultNextItemsConfig()
+	cfg.ColorPriority = map[string]int{"red": 3}
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	want := map[string][]string{
+		"t1": {"home", "next"},
+		"t2": nil,
+		"t3": {"waiting"},
+		"t4": nil,
+		"t5": nil,
+		"t6": {"home", "next"},
+		// errand was set by hand, so only the managed label goes.
+		"t7": {"errand", "waiting"},
+	}
+	for id, labels := range want {
+		if got := store.Task(id).Labels; !sameLabels(got, labels) {
+			t.Errorf("%s labels = %v, want %v", id, got, labels)
+		}
+	}
+	if p := store.Task("t1").Priority; p != godoist.MEDIUM {
+		t.Errorf("t1 priority = %v, want Medium from color", p)
+	}
+	if p := store.Task("t7").Priority; p != godoist.HIGH {
+		t.Errorf("t7 priority = %v, want hand-set High kept", p)
+	}
+}
+
+func TestNextItemsRevertsOnlyOwnedPriority(t *testing.T) {
+	store := testStore()
+	cfg := defaultNextItemsConfig()
+	cfg.ColorPriority = map[string]int{"red": 3}
+	store.Task("t6").Priority = godoist.VERY_LOW
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+	if p := store.Task("t6").Priority; p != godoist.MEDIUM {
+		t.Fatalf("t6 priority = %v, want Medium from color", p)
+	}
+
+	// The user raises t6 by hand, then both tasks stop being next actions.
+	store.Task("t6").Priority = godoist.HIGH
+	store.Task("t1").Labels = append(store.Task("t1").Labels, "waiting")
+	store.Task("t6").Labels = append(store.Task("t6").Labels, "waiting")
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	if p := store.Task("t1").Priority; p != godoist.VERY_LOW {
+		t.Errorf("t1 priority = %v, want color priority reverted", p)
+	}
+	if p := store.Task("t6").Priority; p != godoist.HIGH {
+		t.Errorf("t6 priority = %v, want hand-set High kept", p)
+	}
+}
+
+func TestNextItemsStripsOnlyAddedLabels(t *testing.T) {
+	store := testStore()
+	store.Task("t1").Labels = []string{"phone"}
+	store.Task("t6").Labels = []string{"home"}
+	cfg := defaultNextItemsConfig()
+	cfg.ContextLabels = []string{"errand"}
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+	if ctx, _ := store.GetContext(store.Task("t1")); !sameLabels(labelsValue(ctx[addedLabelsKey]), []string{"home"}) {
+		t.Errorf("t1 context = %v, want added home", ctx)
+	}
+
+	// Both tasks stop being next actions.
+	store.Task("t1").Labels = append(store.Task("t1").Labels, "waiting")
+	store.Task("t6").Labels = append(store.Task("t6").Labels, "waiting")
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	if got := store.Task("t1").Labels; !sameLabels(got, []string{"phone", "waiting"}) {
+		t.Errorf("t1 labels = %v, want the hand-set phone kept and home stripped", got)
+	}
+	if got := store.Task("t6").Labels; !sameLabels(got, []string{"home", "waiting"}) {
+		t.Errorf("t6 labels = %v, want the hand-set home kept", got)
+	}
+	if ctx, _ := store.GetContext(store.Task("t1")); len(ctx) != 0 {
+		t.Errorf("t1 context = %v, want removed", ctx)
+	}
+}
+
+func TestNextItemsWritesNoContextByDefault(t *testing.T) {
+	store := testStore()
+
+	process_next_items(store, defaultNextItemsConfig(), newChangeSet(store, false))
+
+	if len(store.contexts) != 0 {
+		t.Errorf("contexts = %v, want none without context_labels", store.contexts)
+	}
+}
+
+func TestReviewsWithMemoryStore(t *testing.T) {
+	store := testStore()
+	store.Task("t1").Labels = []string{"review"}
+	cfg := defaultReviewsConfig(defaultNextItemsConfig())
+
+	reviews(store, cfg, newChangeSet(store, false))
+
+	if got := store.Task("t2").Labels; !sameLabels(got, []string{"review"}) {
+		t.Errorf("review task labels = %v, want [review]", got)
+	}
+	if got := store.Task("t1").Labels; len(got) != 0 {
+		t.Errorf("stale review labels = %v, want removed", got)
+	}
+}
+
+func TestNextItemsRecursiveAndPrune(t *testing.T) {
+	tests := []struct {
+		name      string
+		recursive bool
+		depth     int
+		prune     bool
+		wantT1    []string
+		wantT7    []string
+	}{
+		{"recursive with prune", true, 0, true, []string{"home", "next"}, []string{"errand", "waiting"}},
+		{"entry project only", false, 0, true, nil, []string{"next", "errand", "waiting"}},
+		{"one level deep", false, 1, true, []string{"home", "next"}, []string{"next", "errand", "waiting"}},
+		{"prune disabled", true, 0, false, []string{"home", "next"}, []string{"next", "errand", "waiting"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := testStore()
+			cfg := defaultNextItemsConfig()
+			cfg.Recursive = tt.recursive
+			cfg.Depth = tt.depth
+			cfg.Prune = tt.prune
+
+			process_next_items(store, cfg, newChangeSet(store, false))
+
+			if got := store.Task("t1").Labels; !sameLabels(got, tt.wantT1) {
+				t.Errorf("t1 labels = %v, want %v", got, tt.wantT1)
+			}
+			if got := store.Task("t7").Labels; !sameLabels(got, tt.wantT7) {
+				t.Errorf("t7 labels = %v, want %v", got, tt.wantT7)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/harlequix/godoist"
+)
+
+// snapshotVersion changes whenever the snapshot layout does; older snapshots
+// are discarded in favor of a full sync.
+const snapshotVersion = 2
+
+// syncResources are the resource types kept in the snapshot cache.
+var syncResources = []string{"items", "projects", "sections", "labels", "notes"}
+
+type syncLabel struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// syncNote is a task comment. Only context comments are kept in the snapshot,
+// so reading a task's context does not need a request of its own.
+type syncNote struct {
+	ID      string `json:"id"`
+	ItemID  string `json:"item_id,omitempty"`
+	TaskID  string `json:"task_id,omitempty"`
+	Content string `json:"content"`
+}
+
+// taskID returns the task the note belongs to. The sync API calls it item_id,
+// the REST API task_id.
+func (n syncNote) taskID() string {
+	if n.ItemID != "" {
+		return n.ItemID
+	}
+	return n.TaskID
+}
+
+// syncSnapshot is the account state persisted between runs, together with the
+// sync token it corresponds to.
+type syncSnapshot struct {
+	Version   int               `json:"version"`
+	SyncToken string            `json:"sync_token"`
+	Account   string            `json:"account"`
+	Projects  []godoist.Project `json:"projects"`
+	Sections  []section         `json:"sections"`
+	Tasks     []godoist.Task    `json:"tasks"`
+	Labels    []syncLabel       `json:"labels"`
+	Notes     []syncNote        `json:"notes"`
+}
+
+// syncFlags are the fields of a sync resource that mark it as gone.
+type syncFlags struct {
+	ID         string `json:"id"`
+	IsDeleted  bool   `json:"is_deleted"`
+	IsArchived bool   `json:"is_archived"`
+	Checked    bool   `json:"checked"`
+}
+
+func (f syncFlags) removed() bool { return f.IsDeleted || f.IsArchived || f.Checked }
+
+type syncResponse struct {
+	SyncToken string            `json:"sync_token"`
+	FullSync  bool              `json:"full_sync"`
+	Items     []json.RawMessage `json:"items"`
+	Projects  []json.RawMessage `json:"projects"`
+	Sections  []json.RawMessage `json:"sections"`
+	Labels    []json.RawMessage `json:"labels"`
+	Notes     []json.RawMessage `json:"notes"`
+}
+
+// accountKey identifies the account a snapshot belongs to without storing the token.
+func accountKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// readSnapshot loads the cached snapshot. A missing or unreadable cache yields
+// nil, which triggers a full sync.
+func readSnapshot(path string) *syncSnapshot {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("Ignoring unreadable sync cache", "path", path, "error", err)
+		}
+		return nil
+	}
+	var snap syncSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		logger.Warn("Ignoring corrupt sync cache", "path", path, "error", err)
+		return nil
+	}
+	return &snap
+}
+
+// writeSnapshot replaces the cache file atomically.
+func writeSnapshot(path string, snap *syncSnapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fetchSync requests everything that changed since syncToken ("*" for a full sync).
+func fetchSync(token, syncToken string) (*syncResponse, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"sync_token":     syncToken,
+		"resource_types": syncResources,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", godoist.APIURL+"/sync", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("sync API error %s: %s", resp.Status, string(body))
+	}
+	var out syncResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("decoding sync response: %w", err)
+	}
+	return &out, nil
+}
+
+// apply merges a sync response into the snapshot. A full sync replaces it.
+func (s *syncSnapshot) apply(resp *syncResponse) error {
+	if resp.FullSync {
+		s.Projects, s.Sections, s.Tasks, s.Labels, s.Notes = nil, nil, nil, nil, nil
+	}
+	var err error
+	if s.Projects, err = mergeResources(s.Projects, resp.Projects, func(p godoist.Project) string { return p.ID }); err != nil {
+		return fmt.Errorf("projects: %w", err)
+	}
+	if s.Sections, err = mergeResources(s.Sections, resp.Sections, func(sec section) string { return sec.ID }); err != nil {
+		return fmt.Errorf("sections: %w", err)
+	}
+	if s.Tasks, err = mergeResources(s.Tasks, resp.Items, func(t godoist.Task) string { return t.ID }); err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	if s.Labels, err = mergeResources(s.Labels, resp.Labels, func(l syncLabel) string { return l.ID }); err != nil {
+		return fmt.Errorf("labels: %w", err)
+	}
+	if s.Notes, err = mergeResources(s.Notes, resp.Notes, func(n syncNote) string { return n.ID }); err != nil {
+		return fmt.Errorf("notes: %w", err)
+	}
+	s.Notes = slices.DeleteFunc(s.Notes, func(n syncNote) bool { return !strings.HasPrefix(n.Content, godoist.ContextPrefix) })
+	s.SyncToken = resp.SyncToken
+	return nil
+}
+
+// mergeResources applies changed resources to current, dropping the ones that
+// were deleted, archived or completed. The result is sorted by ID.
+func mergeResources[T any](current []T, changed []json.RawMessage, id func(T) string) ([]T, error) {
+	byID := make(map[string]T, len(current))
+	for _, r := range current {
+		byID[id(r)] = r
+	}
+	for _, raw := range changed {
+		var flags syncFlags
+		if err := json.Unmarshal(raw, &flags); err != nil {
+			return nil, err
+		}
+		if flags.removed() {
+			delete(byID, flags.ID)
+			continue
+		}
+		var r T
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, err
+		}
+		byID[id(r)] = r
+	}
+	ids := make([]string, 0, len(byID))
+	for k := range byID {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	out := make([]T, 0, len(ids))
+	for _, k := range ids {
+		out = append(out, byID[k])
+	}
+	return out, nil
+}
+
+// incrementalSync brings the cached snapshot at path up to date and returns
+// it. The cache is ignored when full is set, it belongs to another account or
+// was written by a different version.
+func incrementalSync(token, path string, full bool) (*syncSnapshot, error) {
+	account := accountKey(token)
+	snap := readSnapshot(path)
+	if full || snap == nil || snap.Version != snapshotVersion || snap.Account != account || snap.SyncToken == "" {
+		snap = &syncSnapshot{Version: snapshotVersion, Account: account, SyncToken: "*"}
+	}
+	resp, err := fetchSync(token, snap.SyncToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := snap.apply(resp); err != nil {
+		return nil, err
+	}
+	logger.Debug("Synced", "full", resp.FullSync, "items", len(resp.Items), "projects", len(resp.Projects))
+	if err := writeSnapshot(path, snap); err != nil {
+		logger.Warn("Failed to write sync cache", "path", path, "error", err)
+	}
+	return snap, nil
+}
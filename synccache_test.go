@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/harlequix/automadoist/internal/fakeapi"
+	"github.com/harlequix/godoist"
+)
+
+func TestMergeResources(t *testing.T) {
+	current := []syncLabel{{ID: "1", Name: "next"}, {ID: "2", Name: "waiting"}, {ID: "3", Name: "old"}}
+	changed := []json.RawMessage{
+		json.RawMessage(`{"id": "2", "name": "waiting-for"}`),
+		json.RawMessage(`{"id": "3", "is_deleted": true}`),
+		json.RawMessage(`{"id": "0", "name": "home"}`),
+	}
+
+	got, err := mergeResources(current, changed, func(l syncLabel) string { return l.ID })
+	if err != nil {
+		t.Fatalf("mergeResources: %v", err)
+	}
+	want := []string{"home", "next", "waiting-for"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want names %v", got, want)
+	}
+	for i, name := range want {
+		if got[i].Name != name {
+			t.Errorf("label %d = %q, want %q", i, got[i].Name, name)
+		}
+	}
+}
+
+func TestEndToEndIncrementalSync(t *testing.T) {
+	startFake(t, "account.yaml")
+	cache := filepath.Join(t.TempDir(), "sync.json")
+
+	store := newCachedTodoistStore("test-token", cache, false)
+	if err := store.Sync(); err != nil {
+		t.Fatalf("initial sync: %v", err)
+	}
+	tasks := len(store.Tasks())
+	snap := readSnapshot(cache)
+	if snap == nil || snap.SyncToken == "" || len(snap.Tasks) != tasks {
+		t.Fatalf("snapshot after full sync = %+v", snap)
+	}
+
+	if err := store.UpdateTask(store.Task("1"), "labels", []string{"moved"}); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	if err := store.Task("2").Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	store = newCachedTodoistStore("test-token", cache, false)
+	if err := store.Sync(); err != nil {
+		t.Fatalf("incremental sync: %v", err)
+	}
+	if got := store.Task("1").Labels; !sameLabels(got, []string{"moved"}) {
+		t.Errorf("task 1 labels = %v, want [moved]", got)
+	}
+	if store.Task("2") != nil {
+		t.Error("completed task 2 still in snapshot")
+	}
+	if got := len(store.Tasks()); got != tasks-1 {
+		t.Errorf("tasks = %d, want %d", got, tasks-1)
+	}
+
+	// A snapshot for another token is not reused.
+	other := readSnapshot(cache)
+	other.Account = accountKey("someone-else")
+	other.Tasks = nil
+	if err := writeSnapshot(cache, other); err != nil {
+		t.Fatal(err)
+	}
+	store = newCachedTodoistStore("test-token", cache, false)
+	if err := store.Sync(); err != nil {
+		t.Fatalf("sync with foreign cache: %v", err)
+	}
+	if got := len(store.Tasks()); got != tasks-1 {
+		t.Errorf("tasks after resync = %d, want %d", got, tasks-1)
+	}
+
+	// A forced full sync rebuilds the snapshot even with a valid token.
+	snap = readSnapshot(cache)
+	snap.Tasks = nil
+	writeSnapshot(cache, snap)
+	store = newCachedTodoistStore("test-token", cache, true)
+	if err := store.Sync(); err != nil {
+		t.Fatalf("full sync: %v", err)
+	}
+	if got := len(store.Tasks()); got != tasks-1 {
+		t.Errorf("tasks after forced full sync = %d, want %d", got, tasks-1)
+	}
+}
+
+func TestCachedContextComments(t *testing.T) {
+	f, err := fakeapi.LoadFixture(filepath.Join("testdata", "account.yaml"))
+	if err != nil {
+		t.Fatalf("loading fixture: %v", err)
+	}
+	fake := fakeapi.New(f)
+	var reads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/comments" {
+			reads.Add(1)
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	oldURL := godoist.APIURL
+	godoist.APIURL = srv.URL
+	t.Cleanup(func() { godoist.APIURL = oldURL })
+	cache := filepath.Join(t.TempDir(), "sync.json")
+
+	store := newCachedTodoistStore("test-token", cache, false)
+	if err := store.Sync(); err != nil {
+		t.Fatalf("initial sync: %v", err)
+	}
+	task := store.Task("1")
+	if err := store.SetContext(task, map[string]interface{}{"priority": 2.0}); err != nil {
+		t.Fatalf("SetContext: %v", err)
+	}
+	if err := store.SetContext(task, map[string]interface{}{"priority": 3.0}); err != nil {
+		t.Fatalf("SetContext: %v", err)
+	}
+	if got := fake.TaskComments("1"); len(got) != 1 {
+		t.Fatalf("comments = %v, want one context comment", got)
+	}
+
+	store = newCachedTodoistStore("test-token", cache, false)
+	if err := store.Sync(); err != nil {
+		t.Fatalf("incremental sync: %v", err)
+	}
+	ctx, err := store.GetContext(store.Task("1"))
+	if err != nil || ctx["priority"] != 3.0 {
+		t.Errorf("GetContext = %v, %v, want priority 3", ctx, err)
+	}
+	if ctx, _ := store.GetContext(store.Task("2")); len(ctx) != 0 {
+		t.Errorf("task 2 context = %v, want empty", ctx)
+	}
+
+	if err := store.DeleteContext(store.Task("1")); err != nil {
+		t.Fatalf("DeleteContext: %v", err)
+	}
+	store = newCachedTodoistStore("test-token", cache, false)
+	if err := store.Sync(); err != nil {
+		t.Fatalf("sync after delete: %v", err)
+	}
+	if ctx, _ := store.GetContext(store.Task("1")); len(ctx) != 0 {
+		t.Errorf("context after delete = %v, want empty", ctx)
+	}
+	if n := reads.Load(); n != 0 {
+		t.Errorf("made %d comment requests, want contexts served from the sync cache", n)
+	}
+}
+
+func TestTaskCompleted(t *testing.T) {
+	startFake(t, "account.yaml")
+	store := newTodoistStore("test-token")
+	if err := store.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := store.CloseTask(store.Task("2")); err != nil {
+		t.Fatalf("CloseTask: %v", err)
+	}
+	if done, err := store.TaskCompleted("2"); err != nil || !done {
+		t.Errorf("TaskCompleted(closed) = %v, %v, want true", done, err)
+	}
+	if done, err := store.TaskCompleted("no-such-task"); err != nil || done {
+		t.Errorf("TaskCompleted(missing) = %v, %v, want false", done, err)
+	}
+}
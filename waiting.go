@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+// WaitingConfig controls how tasks that have been waiting for too long are
+// followed up.
+type WaitingConfig struct {
+	// Mode is "" (off), "label", "priority" or "create".
+	Mode string `koanf:"mode"`
+	// After is how long a task waits before it is followed up, such as "7d".
+	After string `koanf:"after"`
+	// Labels mark a task as waiting.
+	Labels   []string `koanf:"labels"`
+	Label    string   `koanf:"label"`
+	Priority int      `koanf:"priority"`
+	// Content is the follow-up subtask created in create mode; "{task}" is
+	// replaced by the waiting task's content.
+	Content string `koanf:"content"`
+}
+
+func defaultWaitingConfig() WaitingConfig {
+	return WaitingConfig{
+		After:    "7d",
+		Labels:   []string{"waiting"},
+		Label:    "follow-up",
+		Priority: int(godoist.HIGH),
+		Content:  "Follow up: {task}",
+	}
+}
+
+func (c WaitingConfig) verify() error {
+	switch c.Mode {
+	case "":
+		return nil
+	case "label":
+		if c.Label == "" {
+			return fmt.Errorf("label must not be empty in label mode")
+		}
+	case "priority":
+		if c.Priority < 1 || c.Priority > 4 {
+			return fmt.Errorf("priority must be between 1 and 4")
+		}
+	case "create":
+		if c.Content == "" {
+			return fmt.Errorf("content must not be empty in create mode")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", c.Mode)
+	}
+	if len(c.Labels) == 0 {
+		return fmt.Errorf("labels must not be empty")
+	}
+	if d, err := parseDuration(c.After); err != nil {
+		return fmt.Errorf("after: %w", err)
+	} else if d == 0 {
+		return fmt.Errorf("after must be positive")
+	}
+	return nil
+}
+
+// waitingSinceKey and followedUpKey are the context keys holding when a task
+// was first seen waiting and when it was last followed up.
+const (
+	waitingSinceKey = "waiting_since"
+	followedUpKey   = "followed_up"
+)
+
+// contextTime returns the time stored under key in a context comment.
+func contextTime(ctx map[string]interface{}, key string) (time.Time, bool) {
+	raw, ok := ctx[key].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	return t, err == nil
+}
+
+// followUpContent returns the content of the follow-up subtask for task.
+func followUpContent(cfg WaitingConfig, task *godoist.Task) string {
+	return strings.ReplaceAll(cfg.Content, "{task}", task.Content)
+}
+
+// followUpWaiting records when candidates start waiting and follows up those
+// that have been waiting longer than cfg.Waiting.After: it labels them,
+// raises their priority or adds a follow-up subtask, at most once per
+// interval. Candidates without a waiting label have their record cleared, so
+// waiting again later starts a new interval; in label mode the follow-up label
+// is removed from them as well.
+func followUpWaiting(store taskStore, cfg NextItemsConfig, cs *changeSet, candidates []*godoist.Task, now time.Time) {
+	wc := cfg.Waiting
+	if wc.Mode == "" {
+		return
+	}
+	after, err := parseDuration(wc.After)
+	if err != nil || after == 0 {
+		logger.Warn("Ignoring invalid waiting.after", "after", wc.After)
+		return
+	}
+	var waiting, released []*godoist.Task
+	for _, task := range candidates {
+		if hasLabel(wc.Labels, task) {
+			waiting = append(waiting, task)
+		} else {
+			released = append(released, task)
+		}
+	}
+
+	runParallel(waiting, func(t *godoist.Task) {
+		ctx, err := cs.context(t)
+		if err != nil {
+			logger.Error("Failed to read context", "task", t.Content, "error", err)
+			return
+		}
+		since, ok := contextTime(ctx, waitingSinceKey)
+		if !ok {
+			if err := cs.updateContext(t, map[string]interface{}{waitingSinceKey: now.Format(time.RFC3339)}, "waiting"); err != nil {
+				logger.Error("Failed to update context", "task", t.Content, "error", err)
+			}
+			return
+		}
+		if now.Before(since.Add(after)) {
+			return
+		}
+		if last, ok := contextTime(ctx, followedUpKey); ok && now.Before(last.Add(after)) {
+			return
+		}
+		reason := "waiting since " + since.Format(deferLayout)
+		switch wc.Mode {
+		case "label":
+			err = cs.addLabel(t, wc.Label, reason)
+		case "priority":
+			if t.Priority < godoist.PRIORITY_LEVEL(wc.Priority) {
+				err = cs.setPriority(t, godoist.PRIORITY_LEVEL(wc.Priority), reason)
+			}
+		case "create":
+			if !hasFollowUp(store, t, followUpContent(wc, t)) {
+				_, err = cs.createTask(godoist.Task{Content: followUpContent(wc, t), ProjectID: t.ProjectID, ParentID: t.ID}, reason)
+			}
+		}
+		if err != nil {
+			logger.Error("Failed to follow up", "task", t.Content, "error", err)
+			return
+		}
+		logger.Info("Following up waiting task", "task", t.Content, "since", since)
+		if err := cs.updateContext(t, map[string]interface{}{followedUpKey: now.Format(time.RFC3339)}, reason); err != nil {
+			logger.Error("Failed to update context", "task", t.Content, "error", err)
+		}
+	})
+
+	runParallel(released, func(t *godoist.Task) {
+		if wc.Mode == "label" && cfg.Prune && hasLabel([]string{wc.Label}, t) {
+			if err := cs.removeLabel(t, wc.Label, "no longer waiting"); err != nil {
+				logger.Error("Failed to remove label", "label", wc.Label, "task", t.Content, "error", err)
+			}
+		}
+		if err := cs.updateContext(t, map[string]interface{}{waitingSinceKey: nil, followedUpKey: nil}, "no longer waiting"); err != nil {
+			logger.Error("Failed to update context", "task", t.Content, "error", err)
+		}
+	})
+}
+
+// hasFollowUp reports whether task has an open subtask with the follow-up
+// content.
+func hasFollowUp(store taskStore, task *godoist.Task, content string) bool {
+	for _, c := range store.ChildTasks(task) {
+		if c.Content == content && !c.Checked {
+			return true
+		}
+	}
+	return false
+}
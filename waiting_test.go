@@ -0,0 +1,187 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/harlequix/godoist"
+)
+
+func waitingStore(since time.Time) *memoryStore {
+	store := newMemoryStore(
+		[]godoist.Project{{ID: "root", Name: "projects"}},
+		[]godoist.Task{
+			{ID: "new", Content: "Bob: contract", ProjectID: "root", Labels: []string{"waiting"}, Priority: godoist.VERY_LOW},
+			{ID: "old", Content: "Alice: invoice", ProjectID: "root", Labels: []string{"waiting"}, Priority: godoist.VERY_LOW},
+			{ID: "done", Content: "Carol: keys", ProjectID: "root", Labels: []string{"follow-up"}},
+		},
+	)
+	store.SetContext(store.Task("old"), map[string]interface{}{waitingSinceKey: since.Format(time.RFC3339)})
+	store.SetContext(store.Task("done"), map[string]interface{}{waitingSinceKey: since.Format(time.RFC3339)})
+	return store
+}
+
+func TestFollowUpWaiting(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	since := now.Add(-10 * 24 * time.Hour)
+
+	t.Run("label", func(t *testing.T) {
+		store := waitingStore(since)
+		cfg := defaultNextItemsConfig()
+		cfg.Waiting.Mode = "label"
+
+		followUpWaiting(store, cfg, newChangeSet(store, false), store.Tasks(), now)
+
+		ctx, _ := store.GetContext(store.Task("new"))
+		if got, ok := contextTime(ctx, waitingSinceKey); !ok || !got.Equal(now) {
+			t.Errorf("new waiting_since = %v, want %v", ctx[waitingSinceKey], now)
+		}
+		if hasLabel([]string{"follow-up"}, store.Task("new")) {
+			t.Errorf("new labels = %v, want no follow-up yet", store.Task("new").Labels)
+		}
+		if !hasLabel([]string{"follow-up"}, store.Task("old")) {
+			t.Errorf("old labels = %v, want follow-up", store.Task("old").Labels)
+		}
+		ctx, _ = store.GetContext(store.Task("old"))
+		if _, ok := contextTime(ctx, followedUpKey); !ok {
+			t.Errorf("old context = %v, want followed_up", ctx)
+		}
+		if hasLabel([]string{"follow-up"}, store.Task("done")) {
+			t.Errorf("done labels = %v, want follow-up removed", store.Task("done").Labels)
+		}
+		if ctx, _ := store.GetContext(store.Task("done")); len(ctx) != 0 {
+			t.Errorf("done context = %v, want cleared", ctx)
+		}
+	})
+
+	t.Run("priority", func(t *testing.T) {
+		store := waitingStore(since)
+		cfg := defaultNextItemsConfig()
+		cfg.Waiting.Mode = "priority"
+
+		followUpWaiting(store, cfg, newChangeSet(store, false), store.Tasks(), now)
+
+		if got := store.Task("old").Priority; got != godoist.HIGH {
+			t.Errorf("old priority = %v, want high", got)
+		}
+		if got := store.Task("new").Priority; got != godoist.VERY_LOW {
+			t.Errorf("new priority = %v, want unchanged", got)
+		}
+		// A task seen without a waiting label starts over if it waits again.
+		if ctx, _ := store.GetContext(store.Task("done")); len(ctx) != 0 {
+			t.Errorf("done context = %v, want cleared", ctx)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		store := waitingStore(since)
+		cfg := defaultNextItemsConfig()
+		cfg.Waiting.Mode = "create"
+
+		followUpWaiting(store, cfg, newChangeSet(store, false), store.Tasks(), now)
+		followUpWaiting(store, cfg, newChangeSet(store, false), store.Tasks(), now.Add(24*time.Hour))
+
+		var created []*godoist.Task
+		for _, task := range store.Tasks() {
+			if task.ParentID != "" {
+				created = append(created, task)
+			}
+		}
+		if len(created) != 1 || created[0].Content != "Follow up: Alice: invoice" || created[0].ParentID != "old" {
+			t.Fatalf("created = %+v, want one follow-up below old", created)
+		}
+
+		// Once the follow-up is done and another interval has passed, the
+		// task is followed up again.
+		created[0].Checked = true
+		cs := newChangeSet(store, false)
+		followUpWaiting(store, cfg, cs, store.Tasks(), now.Add(8*24*time.Hour))
+		n := 0
+		for _, c := range cs.Changes() {
+			if c.Field == "created" && c.Content == "Follow up: Alice: invoice" {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("created %d follow-ups for old after another interval, want 1", n)
+		}
+	})
+}
+
+func TestNextActionClearsWaiting(t *testing.T) {
+	store := newMemoryStore(
+		[]godoist.Project{{ID: "root", Name: "projects"}},
+		[]godoist.Task{{ID: "t", Content: "Send draft", ProjectID: "root"}},
+	)
+	store.SetContext(store.Task("t"), map[string]interface{}{waitingSinceKey: "2026-10-01T00:00:00Z"})
+
+	cfg := defaultNextItemsConfig()
+	cfg.Waiting.Mode = "priority"
+
+	process_next_items(store, cfg, newChangeSet(store, false))
+
+	ctx, _ := store.GetContext(store.Task("t"))
+	if _, ok := ctx[waitingSinceKey]; ok {
+		t.Errorf("context = %v, want waiting_since cleared", ctx)
+	}
+}
+
+func TestFollowUpWaitingStaysInScope(t *testing.T) {
+	since := time.Now().Add(-10 * 24 * time.Hour).Format(time.RFC3339)
+	store := newMemoryStore(
+		[]godoist.Project{
+			{ID: "work", Name: "Work"},
+			{ID: "home", Name: "Home"},
+			{ID: "inbox", Name: "Inbox"},
+		},
+		[]godoist.Task{
+			{ID: "w1", Content: "Alice: invoice", ProjectID: "work", Labels: []string{"waiting"}},
+			{ID: "x1", Content: "Bob: contract", ProjectID: "inbox", Labels: []string{"waiting"}},
+		},
+	)
+	for _, id := range []string{"w1", "x1"} {
+		store.SetContext(store.Task(id), map[string]interface{}{waitingSinceKey: since})
+	}
+	cfg := defaultNextItemsConfig()
+	cfg.Roots = []RootConfig{{Project: "Work"}, {Project: "Home"}}
+	cfg.Waiting.Mode = "create"
+
+	// In a dry run the first create is not visible to hasFollowUp, so a task
+	// handled by both scopes would be followed up twice.
+	cs := newChangeSet(store, true)
+	process_next_items(store, cfg, cs)
+
+	var created []string
+	for _, c := range cs.Changes() {
+		if c.Field == "created" {
+			created = append(created, c.Content)
+		}
+	}
+	if len(created) != 1 || created[0] != "Follow up: Alice: invoice" {
+		t.Errorf("created %q, want one follow-up for the task in Work", created)
+	}
+}
+
+func TestWaitingConfigVerify(t *testing.T) {
+	valid := defaultWaitingConfig()
+	tests := []struct {
+		edit    func(c *WaitingConfig)
+		wantErr bool
+	}{
+		{func(c *WaitingConfig) {}, false},
+		{func(c *WaitingConfig) { c.Mode = "label" }, false},
+		{func(c *WaitingConfig) { c.Mode = "label"; c.Label = "" }, true},
+		{func(c *WaitingConfig) { c.Mode = "priority"; c.Priority = 5 }, true},
+		{func(c *WaitingConfig) { c.Mode = "create"; c.Content = "" }, true},
+		{func(c *WaitingConfig) { c.Mode = "create"; c.After = "soon" }, true},
+		{func(c *WaitingConfig) { c.Mode = "create"; c.Labels = nil }, true},
+		{func(c *WaitingConfig) { c.Mode = "email" }, true},
+	}
+	for i, tt := range tests {
+		c := valid
+		tt.edit(&c)
+		if err := c.verify(); (err != nil) != tt.wantErr {
+			t.Errorf("case %d: verify(%+v) = %v, want error %v", i, c, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// signatureHeader carries the base64 HMAC-SHA256 of the request body, keyed
+// with the app's client secret.
+const signatureHeader = "X-Todoist-Hmac-SHA256"
+
+const maxWebhookBody = 1 << 20
+
+type ServeConfig struct {
+	Listen       string `koanf:"listen"`
+	Path         string `koanf:"path"`
+	ClientSecret string `koanf:"client_secret"`
+}
+
+// serveFlags override the serve section of the configuration.
+var serveFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "listen",
+		Usage: "Address to listen on",
+	},
+}
+
+// applyFlags copies the serveFlags that were set on the command line, which
+// the koanf flag provider does not map to the serve section.
+func (s *ServeConfig) applyFlags(c *cli.Context) {
+	if c.IsSet("listen") {
+		s.Listen = c.String("listen")
+	}
+}
+
+func defaultServeConfig() ServeConfig {
+	return ServeConfig{
+		Listen: ":8080",
+		Path:   "/webhook",
+	}
+}
+
+func (c ServeConfig) verify() error {
+	if c.ClientSecret == "" {
+		return fmt.Errorf("client_secret is required to verify webhook signatures")
+	}
+	if c.Listen == "" || c.Path == "" {
+		return fmt.Errorf("listen and path must not be empty")
+	}
+	return nil
+}
+
+type webhookEvent struct {
+	EventName string                 `json:"event_name"`
+	UserID    string                 `json:"user_id"`
+	EventData map[string]interface{} `json:"event_data"`
+}
+
+// projectID returns the project whose next actions may have changed, or "" if
+// the event does not affect next actions.
+func (e webhookEvent) projectID() string {
+	switch e.EventName {
+	case "item:added", "item:completed", "item:uncompleted", "item:updated", "item:deleted":
+		return stringValue(e.EventData["project_id"])
+	case "project:updated":
+		return stringValue(e.EventData["id"])
+	}
+	return ""
+}
+
+func signPayload(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifySignature(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signPayload(secret, body)), []byte(signature))
+}
+
+// webhookHandler verifies Todoist webhook deliveries and hands the affected
+// project to dispatch.
+type webhookHandler struct {
+	secret   []byte
+	dispatch func(projectID string)
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "reading body", http.StatusBadRequest)
+		return
+	}
+	if !verifySignature(h.secret, body, r.Header.Get(signatureHeader)) {
+		logger.Warn("Rejected webhook with invalid signature", "remote", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	var event webhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	logger.Debug("Received webhook", "event", event.EventName)
+	if id := event.projectID(); id != "" {
+		h.dispatch(id)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// projectQueue collects projects to recompute. Events that arrive while a
+// batch is being processed are coalesced into the next batch.
+type projectQueue struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	wake    chan struct{}
+}
+
+func newProjectQueue() *projectQueue {
+	return &projectQueue{pending: map[string]bool{}, wake: make(chan struct{}, 1)}
+}
+
+func (q *projectQueue) add(projectID string) {
+	q.mu.Lock()
+	q.pending[projectID] = true
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *projectQueue) take() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids := sortedKeys(q.pending)
+	q.pending = map[string]bool{}
+	return ids
+}
+
+// run hands each batch of queued projects to process until ctx is cancelled.
+func (q *projectQueue) run(ctx context.Context, process func(projectIDs []string) error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+		ids := q.take()
+		if len(ids) == 0 {
+			continue
+		}
+		if err := process(ids); err != nil {
+			logger.Error("Processing webhook batch failed", "projects", ids, "error", err)
+		}
+	}
+}
+
+// processWebhookBatch recomputes next actions for the given project subtrees
+// with the same configuration as the next_items pipeline. previous maps task
+// IDs to their projects as of the last batch; the events of a moved task only
+// name its new project, so the one it left is recomputed as well.
+func processWebhookBatch(store taskStore, cfg *config, cs *changeSet, projectIDs []string, previous map[string]string) {
+	projectIDs = mergeIDs(projectIDs, movedFrom(store, previous))
+	// Tasks elsewhere may have been waiting for a task in these projects.
+	projectIDs = mergeIDs(projectIDs, dependentProjects(store))
+	for _, id := range outermostProjects(store, projectIDs) {
+		processNextItemsSubtree(store, cfg.nextItemsConfig(), cs, id)
+	}
+}
+
+// taskProjects maps every task to its project.
+func taskProjects(store taskStore) map[string]string {
+	out := map[string]string{}
+	for _, t := range store.Tasks() {
+		out[t.ID] = t.ProjectID
+	}
+	return out
+}
+
+// movedFrom returns the projects that tasks have left since previous was taken.
+func movedFrom(store taskStore, previous map[string]string) []string {
+	left := map[string]bool{}
+	for _, t := range store.Tasks() {
+		if from, ok := previous[t.ID]; ok && from != t.ProjectID {
+			left[from] = true
+		}
+	}
+	return sortedKeys(left)
+}
+
+// outermostProjects drops projects whose parent project is also in ids, as
+// their subtree is recomputed with the parent's.
+func outermostProjects(store taskStore, ids []string) []string {
+	var out []string
+	for _, id := range ids {
+		project := store.Project(id)
+		nested := false
+		for _, other := range ids {
+			if root := store.Project(other); project != nil && root != nil && other != id && isInSubtree(store, project, root) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// serveWebhooks listens for webhook deliveries until ctx is cancelled and
+// recomputes next actions for the affected project subtrees.
+func serveWebhooks(ctx context.Context, cfg *config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := newProjectQueue()
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Serve.Path, &webhookHandler{secret: []byte(cfg.Serve.ClientSecret), dispatch: queue.add})
+	srv := &http.Server{Addr: cfg.Serve.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var previous map[string]string
+		if store, err := openStore(cfg); err != nil {
+			logger.Warn("Initial sync failed, moved tasks are tracked from the first batch on", "error", err)
+		} else {
+			previous = taskProjects(store)
+		}
+		queue.run(ctx, func(projectIDs []string) error {
+			store, err := openStore(cfg)
+			if err != nil {
+				return err
+			}
+			processWebhookBatch(store, cfg, newRunChangeSet(store, cfg, false), projectIDs, previous)
+			previous = taskProjects(store)
+			return store.Commit()
+		})
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Listening for webhooks", "addr", cfg.Serve.Listen, "path", cfg.Serve.Path)
+	err := srv.ListenAndServe()
+	cancel()
+	<-done
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func mergeIDs(a, b []string) []string {
+	set := map[string]bool{}
+	for _, id := range append(append([]string{}, a...), b...) {
+		set[id] = true
+	}
+	return sortedKeys(set)
+}
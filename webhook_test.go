@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/harlequix/godoist"
+	"github.com/urfave/cli/v2"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	secret := []byte("client-secret")
+	tests := []struct {
+		name       string
+		body       string
+		signature  string
+		wantStatus int
+		wantID     string
+	}{
+		{
+			name:       "item completed",
+			body:       `{"event_name":"item:completed","event_data":{"id":"t5","project_id":"p1"}}`,
+			wantStatus: http.StatusOK,
+			wantID:     "p1",
+		},
+		{
+			name:       "project updated",
+			body:       `{"event_name":"project:updated","event_data":{"id":"p1"}}`,
+			wantStatus: http.StatusOK,
+			wantID:     "p1",
+		},
+		{
+			name:       "unrelated event",
+			body:       `{"event_name":"note:added","event_data":{"id":"n1"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "bad signature",
+			body:       `{"event_name":"item:added","event_data":{"project_id":"p1"}}`,
+			signature:  "forged",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid payload",
+			body:       `not json`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			h := &webhookHandler{secret: secret, dispatch: func(id string) { got = append(got, id) }}
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			sig := tt.signature
+			if sig == "" {
+				sig = signPayload(secret, []byte(tt.body))
+			}
+			req.Header.Set(signatureHeader, sig)
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantID == "" && len(got) != 0 || tt.wantID != "" && (len(got) != 1 || got[0] != tt.wantID) {
+				t.Errorf("dispatched %v, want %q", got, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestProjectQueueCoalesces(t *testing.T) {
+	q := newProjectQueue()
+	q.add("p2")
+	q.add("p1")
+	q.add("p2")
+	if got := q.take(); len(got) != 2 || got[0] != "p1" || got[1] != "p2" {
+		t.Errorf("take() = %v, want [p1 p2]", got)
+	}
+	if got := q.take(); len(got) != 0 {
+		t.Errorf("take() after drain = %v, want empty", got)
+	}
+}
+
+func TestProcessNextItemsSubtree(t *testing.T) {
+	store := testStore()
+	cs := newChangeSet(store, false)
+
+	processNextItemsSubtree(store, defaultNextItemsConfig(), cs, "p1")
+
+	if got := store.Task("t6").Labels; !sameLabels(got, []string{"home", "next"}) {
+		t.Errorf("t6 labels = %v, want [home next]", got)
+	}
+	// t7 lives outside the subtree and keeps its stale label.
+	if got := store.Task("t7").Labels; !sameLabels(got, []string{"next", "errand", "waiting"}) {
+		t.Errorf("t7 labels = %v, want untouched", got)
+	}
+
+	before := len(cs.Changes())
+	processNextItemsSubtree(store, defaultNextItemsConfig(), cs, "other")
+	if after := len(cs.Changes()); after != before {
+		t.Errorf("project outside entry point produced %d changes", after-before)
+	}
+}
+
+func TestProcessWebhookBatchKeepsReviewLabel(t *testing.T) {
+	store := newMemoryStore(
+		// A default tag that is also the review label would be stripped
+		// with @next unless next_items retains it.
+		[]godoist.Project{{ID: "root", Name: "projects", Description: "[automadoist:tags=review]"}},
+		[]godoist.Task{
+			{ID: "t1", Content: "*Weekly review", ProjectID: "root", Labels: []string{"next", "review"}},
+			{ID: "t2", Content: "Write report", ProjectID: "root"},
+		},
+	)
+	cfg := defaultConfig
+	cfg.NextItems.IgnoreLabels = []string{"waiting"}
+
+	processWebhookBatch(store, &cfg, newChangeSet(store, false), []string{"root"}, nil)
+
+	if got := store.Task("t1").Labels; !sameLabels(got, []string{"review"}) {
+		t.Errorf("t1 labels = %v, want [review]", got)
+	}
+}
+
+func TestServeFlags(t *testing.T) {
+	cfg := defaultServeConfig()
+	app := &cli.App{Commands: []*cli.Command{{
+		Name:   "serve",
+		Flags:  serveFlags,
+		Action: func(c *cli.Context) error { cfg.applyFlags(c); return nil },
+	}}}
+	if err := app.Run([]string{"automadoist", "serve", "--listen", "127.0.0.1:9000"}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if cfg.Listen != "127.0.0.1:9000" {
+		t.Errorf("Listen = %q, want the flag value", cfg.Listen)
+	}
+	if cfg.Path != defaultServeConfig().Path {
+		t.Errorf("Path = %q, want the default kept", cfg.Path)
+	}
+}
+
+func TestProcessWebhookBatchRecomputesProjectLeftByMove(t *testing.T) {
+	store := newMemoryStore(
+		[]godoist.Project{
+			{ID: "root", Name: "projects"},
+			{ID: "a", Name: "A", ParentID: "root", Description: "[automadoist:sequential]"},
+			{ID: "b", Name: "B", ParentID: "root"},
+		},
+		[]godoist.Task{
+			// t1 was A's next action until it was moved to B.
+			{ID: "t1", Content: "Draft", ProjectID: "b", Labels: []string{"next"}, ChildOrder: 1},
+			{ID: "t2", Content: "Review", ProjectID: "a", ChildOrder: 2},
+		},
+	)
+	cfg := defaultConfig
+
+	processWebhookBatch(store, &cfg, newChangeSet(store, false), []string{"b"}, map[string]string{"t1": "a", "t2": "a"})
+
+	if got := store.Task("t2").Labels; !sameLabels(got, []string{"next"}) {
+		t.Errorf("t2 labels = %v, want [next] once A is recomputed", got)
+	}
+}
+
+func TestOutermostProjects(t *testing.T) {
+	store := newMemoryStore(
+		[]godoist.Project{
+			{ID: "root", Name: "projects"},
+			{ID: "area", Name: "Area", ParentID: "root"},
+			{ID: "sub", Name: "Sub", ParentID: "area"},
+			{ID: "other", Name: "Other"},
+		},
+		nil,
+	)
+	if got := outermostProjects(store, []string{"area", "other", "sub"}); len(got) != 2 || got[0] != "area" || got[1] != "other" {
+		t.Errorf("outermostProjects() = %v, want [area other]", got)
+	}
+}